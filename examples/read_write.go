@@ -141,6 +141,9 @@ func main() {
 		fmt.Printf("new client fail, err: %v\n", err)
 		return
 	}
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
 
 	fmt.Println("------------------------------------------------------------------")
 	fmt.Println("### exists table:")
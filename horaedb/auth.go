@@ -0,0 +1,135 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// tokenRefreshWindow is how long before its expiry a token is refreshed.
+const tokenRefreshWindow = 30 * time.Second
+
+// Token is a bearer token, a zero Expiry means the token never expires.
+type Token struct {
+	Value  string
+	Expiry time.Time
+}
+
+// TokenSource fetches a new token, it is called again shortly before the previous token expires.
+type TokenSource interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// TokenSourceFunc adapts a function to TokenSource.
+type TokenSourceFunc func(ctx context.Context) (Token, error)
+
+func (f TokenSourceFunc) Token(ctx context.Context) (Token, error) {
+	return f(ctx)
+}
+
+type bearerTokenCredentials struct {
+	source     TokenSource
+	requireTLS bool
+
+	mutex sync.Mutex
+	token Token
+}
+
+// NewBearerTokenCredentials sends "authorization: Bearer <token>" with every RPC and refreshes the token before it expires.
+// requireTLS refuses to send the token over a connection without TLS.
+func NewBearerTokenCredentials(source TokenSource, requireTLS bool) credentials.PerRPCCredentials {
+	return &bearerTokenCredentials{
+		source:     source,
+		requireTLS: requireTLS,
+	}
+}
+
+func (c *bearerTokenCredentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token.Value == "" || (!c.token.Expiry.IsZero() && time.Now().Add(tokenRefreshWindow).After(c.token.Expiry)) {
+		token, err := c.source.Token(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.token = token
+	}
+
+	return map[string]string{
+		"authorization": "Bearer " + c.token.Value,
+	}, nil
+}
+
+func (c *bearerTokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+type basicAuthCredentials struct {
+	header     string
+	requireTLS bool
+}
+
+// NewBasicAuthCredentials sends "authorization: Basic <base64(username:password)>" with every RPC.
+// requireTLS refuses to send the password over a connection without TLS.
+func NewBasicAuthCredentials(username, password string, requireTLS bool) credentials.PerRPCCredentials {
+	return &basicAuthCredentials{
+		header:     "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password)),
+		requireTLS: requireTLS,
+	}
+}
+
+func (c *basicAuthCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": c.header,
+	}, nil
+}
+
+func (c *basicAuthCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
+
+// withOutgoingMetadata attaches the static metadata of the client and the metadata of the request to ctx,
+// the request value wins for a key in both. Keys are case-insensitive like in gRPC.
+func withOutgoingMetadata(ctx context.Context, static map[string]string, reqCtx RequestContext) context.Context {
+	if len(static) == 0 && len(reqCtx.Metadata) == 0 {
+		return ctx
+	}
+
+	merged := make(map[string]string, len(static)+len(reqCtx.Metadata))
+	for k, v := range static {
+		merged[strings.ToLower(k)] = v
+	}
+	for k, v := range reqCtx.Metadata {
+		merged[strings.ToLower(k)] = v
+	}
+	kv := make([]string, 0, 2*len(merged))
+	for k, v := range merged {
+		kv = append(kv, k, v)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
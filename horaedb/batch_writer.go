@@ -0,0 +1,453 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BatchResult reports the outcome of one batch flushed by BatchWriter.
+type BatchResult struct {
+	Points   []Point
+	Response WriteResponse
+	Err      error
+}
+
+type BatchWriterOption interface {
+	apply(*batchWriterOptions)
+}
+
+type batchWriterOptions struct {
+	ReqCtx            RequestContext
+	MaxPoints         int
+	MaxBytes          int
+	FlushInterval     time.Duration
+	QueueSize         int
+	MaxBufferedPoints int
+	Callback          func(BatchResult)
+	ResultChan        chan<- BatchResult
+}
+
+type batchWriterFuncOption struct {
+	f func(*batchWriterOptions)
+}
+
+func (fdo *batchWriterFuncOption) apply(do *batchWriterOptions) {
+	fdo.f(do)
+}
+
+func newBatchWriterFuncOption(f func(*batchWriterOptions)) *batchWriterFuncOption {
+	return &batchWriterFuncOption{
+		f: f,
+	}
+}
+
+func defaultBatchWriterOptions() *batchWriterOptions {
+	return &batchWriterOptions{
+		MaxPoints:         1000,
+		MaxBytes:          4 * 1024 * 1024,
+		FlushInterval:     time.Second,
+		QueueSize:         16,
+		MaxBufferedPoints: 100 * 1000,
+	}
+}
+
+// WithBatchRequestContext sets the RequestContext used by every write of the BatchWriter.
+func WithBatchRequestContext(reqCtx RequestContext) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.ReqCtx = reqCtx
+	})
+}
+
+// WithBatchMaxPoints flushes the batch of a table once it holds this many points.
+func WithBatchMaxPoints(points int) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.MaxPoints = points
+	})
+}
+
+// WithBatchMaxBytes flushes the batch of a table once its estimated size reaches this many bytes.
+func WithBatchMaxBytes(bytes int) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.MaxBytes = bytes
+	})
+}
+
+// WithBatchFlushInterval flushes all buffered points periodically, zero disables it.
+func WithBatchFlushInterval(interval time.Duration) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.FlushInterval = interval
+	})
+}
+
+// WithBatchQueueSize sets how many full batches may wait for the background writer.
+func WithBatchQueueSize(size int) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.QueueSize = size
+	})
+}
+
+// WithBatchMaxBufferedPoints bounds the points held in memory, Add fails with ErrBatchWriterFull beyond it.
+func WithBatchMaxBufferedPoints(points int) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.MaxBufferedPoints = points
+	})
+}
+
+// WithBatchCallback is called from the background writer after every flushed batch.
+func WithBatchCallback(callback func(BatchResult)) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.Callback = callback
+	})
+}
+
+// WithBatchResultChan receives every flushed batch result, the background writer blocks until it is consumed.
+func WithBatchResultChan(ch chan<- BatchResult) BatchWriterOption {
+	return newBatchWriterFuncOption(func(o *batchWriterOptions) {
+		o.ResultChan = ch
+	})
+}
+
+type pointBatch struct {
+	points []Point
+	bytes  int
+}
+
+// batchKey groups the points of a table by the endpoint it is routed to.
+type batchKey struct {
+	table    string
+	endpoint string // empty if the route of the table is not cached
+}
+
+// endpointResolver is implemented by the Client of NewClient, it lets BatchWriter group points by endpoint.
+type endpointResolver interface {
+	cachedEndpoint(reqCtx RequestContext, table string) string
+}
+
+type flushTask struct {
+	ctx     context.Context
+	batches [][]Point     // one Client.Write per batch
+	done    chan struct{} // closed after the task is written, nil for background flush
+}
+
+// BatchWriter buffers points per table and endpoint in front of a Client and writes them in the background.
+// A batch is flushed when it is full, and all batches are flushed every FlushInterval with one Client.Write per endpoint.
+// The endpoint of a table comes from the route cache, the points of uncached tables are split by Client.Write.
+type BatchWriter struct {
+	client Client
+	opts   batchWriterOptions
+
+	mutex    sync.Mutex
+	batches  map[batchKey]*pointBatch
+	buffered int // points accepted but not written yet
+	closed   bool
+	dropped  bool // the stopped writer has reported the points left in batches
+
+	// ctx bounds the background flushes, it is cancelled when the writer stops.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	flushCh  chan flushTask
+	stopOnce sync.Once
+	stopCh   chan struct{}
+	stopped  chan struct{}
+}
+
+func NewBatchWriter(client Client, opts ...BatchWriterOption) *BatchWriter {
+	defaultOpts := defaultBatchWriterOptions()
+	for _, opt := range opts {
+		opt.apply(defaultOpts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &BatchWriter{
+		client:  client,
+		opts:    *defaultOpts,
+		batches: make(map[batchKey]*pointBatch),
+		ctx:     ctx,
+		cancel:  cancel,
+		flushCh: make(chan flushTask, defaultOpts.QueueSize),
+		stopCh:  make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Add buffers the point without waiting for any write.
+func (w *BatchWriter) Add(point Point) error {
+	if err := checkPoint(point); err != nil {
+		return err
+	}
+	key := w.batchKeyOf(point.Table)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	if w.opts.MaxBufferedPoints > 0 && w.buffered >= w.opts.MaxBufferedPoints {
+		return ErrBatchWriterFull
+	}
+
+	batch := w.addLocked(key, point)
+	w.buffered++
+
+	if w.isBatchFull(batch) {
+		select {
+		case w.flushCh <- flushTask{ctx: w.ctx, batches: [][]Point{batch.points}}:
+			delete(w.batches, key)
+		default:
+			// The queue is full, keep buffering and try again on the next Add.
+		}
+	}
+	return nil
+}
+
+// Flush writes all buffered points and waits until they are written, it fails after Close.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrBatchWriterClosed
+	}
+	w.mutex.Unlock()
+
+	return w.flush(ctx)
+}
+
+func (w *BatchWriter) flush(ctx context.Context) error {
+	w.mutex.Lock()
+	batches := w.takeAllLocked()
+	w.mutex.Unlock()
+
+	// Always enqueue a task, it is done only after all the batches queued before it.
+	task := flushTask{ctx: ctx, batches: batches, done: make(chan struct{})}
+	select {
+	case w.flushCh <- task:
+	case <-w.stopped:
+		w.requeue(batches)
+		return ErrBatchWriterClosed
+	case <-ctx.Done():
+		w.requeue(batches)
+		return ctx.Err()
+	}
+
+	select {
+	case <-task.done:
+		return nil
+	case <-w.stopped:
+		// The task may be the last one drained before stopping.
+		select {
+		case <-task.done:
+			return nil
+		default:
+			return ErrBatchWriterClosed
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes all buffered points and stops the background writer, Add and Flush fail after Close.
+// The writer is stopped even if the final flush fails, a second Close waits until it is stopped.
+// The points not written in time are reported to the callback and the result chan with an error.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	w.mutex.Lock()
+	closed := w.closed
+	w.closed = true
+	w.mutex.Unlock()
+
+	var err error
+	if !closed {
+		err = w.flush(ctx)
+		w.stop()
+	}
+
+	select {
+	case <-w.stopped:
+		return err
+	case <-ctx.Done():
+		if err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
+
+// stop cancels the background flushes and the run loop.
+func (w *BatchWriter) stop() {
+	w.stopOnce.Do(func() {
+		w.cancel()
+		close(w.stopCh)
+	})
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.stopped)
+
+	var tick <-chan time.Time
+	if w.opts.FlushInterval > 0 {
+		ticker := time.NewTicker(w.opts.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case task := <-w.flushCh:
+			w.writeTask(task)
+		case <-tick:
+			w.mutex.Lock()
+			batches := w.takeAllLocked()
+			w.mutex.Unlock()
+			for _, points := range batches {
+				w.write(w.ctx, points)
+			}
+		case <-w.stopCh:
+			w.drain()
+			w.drop()
+			return
+		}
+	}
+}
+
+// drain writes the tasks queued by the flushes racing with Close, so that none of them waits forever.
+func (w *BatchWriter) drain() {
+	for {
+		select {
+		case task := <-w.flushCh:
+			w.writeTask(task)
+		default:
+			return
+		}
+	}
+}
+
+// drop reports the points left after the writer is stopped, they are never written.
+func (w *BatchWriter) drop() {
+	w.mutex.Lock()
+	batches := w.takeAllLocked()
+	w.dropped = true
+	w.mutex.Unlock()
+
+	for _, points := range batches {
+		w.report(points, WriteResponse{}, ErrBatchWriterClosed)
+	}
+}
+
+func (w *BatchWriter) writeTask(task flushTask) {
+	for _, points := range task.batches {
+		w.write(task.ctx, points)
+	}
+	if task.done != nil {
+		close(task.done)
+	}
+}
+
+func (w *BatchWriter) write(ctx context.Context, points []Point) {
+	if len(points) == 0 {
+		return
+	}
+
+	resp, err := w.client.Write(ctx, WriteRequest{
+		ReqCtx: w.opts.ReqCtx,
+		Points: points,
+	})
+	w.report(points, resp, err)
+}
+
+func (w *BatchWriter) report(points []Point, resp WriteResponse, err error) {
+	w.mutex.Lock()
+	w.buffered -= len(points)
+	w.mutex.Unlock()
+
+	result := BatchResult{
+		Points:   points,
+		Response: resp,
+		Err:      err,
+	}
+	if w.opts.Callback != nil {
+		w.opts.Callback(result)
+	}
+	if w.opts.ResultChan != nil {
+		w.opts.ResultChan <- result
+	}
+}
+
+func (w *BatchWriter) isBatchFull(batch *pointBatch) bool {
+	return (w.opts.MaxPoints > 0 && len(batch.points) >= w.opts.MaxPoints) ||
+		(w.opts.MaxBytes > 0 && batch.bytes >= w.opts.MaxBytes)
+}
+
+func (w *BatchWriter) batchKeyOf(table string) batchKey {
+	key := batchKey{table: table}
+	if resolver, ok := w.client.(endpointResolver); ok {
+		key.endpoint = resolver.cachedEndpoint(w.opts.ReqCtx, table)
+	}
+	return key
+}
+
+func (w *BatchWriter) addLocked(key batchKey, point Point) *pointBatch {
+	batch, ok := w.batches[key]
+	if !ok {
+		batch = &pointBatch{}
+		w.batches[key] = batch
+	}
+	batch.points = append(batch.points, point)
+	batch.bytes += pointSize(point)
+	return batch
+}
+
+// takeAllLocked takes all the buffered points, the points routed to the same endpoint are written together.
+func (w *BatchWriter) takeAllLocked() [][]Point {
+	byEndpoint := make(map[string][]Point)
+	for key, batch := range w.batches {
+		byEndpoint[key.endpoint] = append(byEndpoint[key.endpoint], batch.points...)
+		delete(w.batches, key)
+	}
+
+	batches := make([][]Point, 0, len(byEndpoint))
+	for _, points := range byEndpoint {
+		batches = append(batches, points)
+	}
+	return batches
+}
+
+// requeue puts back the points of a flush that is given up, or reports them if the writer is already stopped.
+func (w *BatchWriter) requeue(batches [][]Point) {
+	w.mutex.Lock()
+	if w.dropped {
+		w.mutex.Unlock()
+		for _, points := range batches {
+			w.report(points, WriteResponse{}, ErrBatchWriterClosed)
+		}
+		return
+	}
+	defer w.mutex.Unlock()
+
+	for _, points := range batches {
+		for _, point := range points {
+			w.addLocked(w.batchKeyOf(point.Table), point)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+const defaultProbeTimeout = 5 * time.Second
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// CircuitOpenError is returned without sending the RPC when the endpoint failed too many times in a row.
+// It matches ErrCircuitOpen and ErrUnavailable with errors.Is.
+type CircuitOpenError struct {
+	Endpoint string
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s, endpoint:%s", ErrCircuitOpen.Error(), e.Endpoint)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen || target == ErrUnavailable
+}
+
+// circuitBreaker trips after consecutive unavailable failures of an endpoint. When it has been open for
+// the open timeout it turns half-open and one health probe decides whether it closes or opens again.
+type circuitBreaker struct {
+	mutex    sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+}
+
+// allow reports whether a request may be sent, and whether the caller should start the probe.
+func (b *circuitBreaker) allow(openTimeout time.Duration) (allowed bool, probe bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < openTimeout {
+			return false, false
+		}
+		b.state = breakerHalfOpen
+		return false, true
+	case breakerHalfOpen:
+		return false, false
+	default:
+		return true, false
+	}
+}
+
+func (b *circuitBreaker) record(failed bool, threshold int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.state != breakerClosed {
+		// Only the probe moves the breaker out of open or half-open.
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= threshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *circuitBreaker) probed(healthy bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if healthy {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+	b.state = breakerOpen
+	b.openedAt = time.Now()
+}
+
+// checkBreaker fails fast when the breaker of the endpoint is open.
+func (c *rpcClient) checkBreaker(endpoint string) error {
+	if c.opts.BreakerThreshold <= 0 {
+		return nil
+	}
+
+	v, ok := c.breakers.Load(endpoint)
+	if !ok {
+		return nil
+	}
+	breaker := v.(*circuitBreaker)
+	allowed, probe := breaker.allow(c.opts.BreakerOpenTimeout)
+	if probe {
+		go c.probe(endpoint, breaker)
+	}
+	if !allowed {
+		return &CircuitOpenError{Endpoint: endpoint}
+	}
+	return nil
+}
+
+// recordResult feeds the result of an RPC to the breaker of the endpoint, ctx is the context of the
+// caller. A timeout only counts as a failure when it is not the deadline of the caller.
+func (c *rpcClient) recordResult(ctx context.Context, endpoint string, err error) {
+	if c.opts.BreakerThreshold <= 0 {
+		return
+	}
+
+	failed := isEndpointUnavailable(err) || (errors.Is(err, ErrTimeout) && ctx.Err() == nil)
+	v, ok := c.breakers.Load(endpoint)
+	if !ok {
+		if !failed {
+			return
+		}
+		v, _ = c.breakers.LoadOrStore(endpoint, &circuitBreaker{})
+	}
+	v.(*circuitBreaker).record(failed, c.opts.BreakerThreshold)
+}
+
+// probe checks the endpoint with the gRPC health protocol. A server without the health service answers
+// Unimplemented, which still proves that it is reachable.
+func (c *rpcClient) probe(endpoint string, breaker *circuitBreaker) {
+	grpcConn, release, err := c.getGrpcConn(endpoint)
+	if err != nil {
+		breaker.probed(false)
+		return
+	}
+	defer release()
+
+	ctx, cancel := withDefaultTimeout(context.Background(), defaultProbeTimeout)
+	defer cancel()
+	resp, err := grpc_health_v1.NewHealthClient(grpcConn).Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	healthy := (err == nil && resp.Status == grpc_health_v1.HealthCheckResponse_SERVING) || status.Code(err) == codes.Unimplemented
+	if c.opts.LoggerDebug {
+		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Probe endpoint for circuit breaker, endpoint:%s, healthy:%v, err:%v\n", endpoint, healthy, err)))
+	}
+	breaker.probed(healthy)
+}
+
+// forgetEndpoint drops the breaker of an endpoint which left the discovered endpoints, unless it is
+// still routed. The breakers of unrouted endpoints are also dropped when their idle conn is evicted.
+func (c *rpcClient) forgetEndpoint(endpoint string) {
+	if !c.isRouted(endpoint) {
+		c.breakers.Delete(endpoint)
+	}
+}
@@ -33,12 +33,31 @@ const (
 type Client interface {
 	Write(context.Context, WriteRequest) (WriteResponse, error)
 	SQLQuery(context.Context, SQLQueryRequest) (SQLQueryResponse, error)
+	Close(context.Context) error
+}
+
+// StreamWriteClient is implemented by the clients of NewClient. It is not part of Client, so other
+// implementations of Client keep working, type-assert a Client to use it.
+type StreamWriteClient interface {
+	StreamWrite(context.Context, RequestContext) (*StreamWriter, error)
+}
+
+// QueryStreamClient is implemented by the clients of NewClient, type-assert a Client to use it.
+type QueryStreamClient interface {
+	QueryStream(context.Context, SQLQueryRequest) (*RowIterator, error)
 }
 
 func NewClient(endpoint string, routeMode RouteMode, opts ...Option) (Client, error) {
+	return NewClientWithEndpoints([]string{endpoint}, routeMode, opts...)
+}
+
+// NewClientWithEndpoints creates a client with several endpoints. In Direct mode they are the seeds of route
+// discovery and are tried in turn, in Proxy mode requests are spread over them. Unreachable endpoints are
+// skipped for a while.
+func NewClientWithEndpoints(endpoints []string, routeMode RouteMode, opts ...Option) (Client, error) {
 	defaultOpts := defaultOptions()
 	for _, opt := range opts {
 		opt.apply(defaultOpts)
 	}
-	return newClient(endpoint, routeMode, *defaultOpts)
+	return newClient(endpoints, routeMode, *defaultOpts)
 }
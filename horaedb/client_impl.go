@@ -21,7 +21,7 @@ package horaedb
 
 import (
 	"context"
-	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 )
@@ -29,60 +29,101 @@ import (
 type clientImpl struct {
 	rpcClient   *rpcClient
 	routeClient routeClient
+	limiter     *writeLimiter // nil if writes are not limited
+	proxies     *endpointSet  // nil if there is no query proxy
+
+	mutex    sync.Mutex // protect closed and the start of inflight requests
+	closed   bool
+	inflight sync.WaitGroup
 }
 
-func newClient(endpoint string, routeMode RouteMode, opts options) (Client, error) {
-	rpcClient := newRPCClient(opts)
-	routeClient, err := newRouteClient(endpoint, routeMode, rpcClient, opts)
+func newClient(endpoints []string, routeMode RouteMode, opts options) (Client, error) {
+	rpcClient, err := newRPCClient(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "init rpc client")
+	}
+	routeClient, err := newRouteClient(endpoints, routeMode, rpcClient, opts)
 	if err != nil {
+		_ = rpcClient.Close()
 		return nil, err
 	}
-	return &clientImpl{
+	c := &clientImpl{
 		rpcClient:   rpcClient,
 		routeClient: routeClient,
-	}, nil
+		limiter:     newWriteLimiter(opts),
+	}
+	if len(opts.QueryProxies) > 0 {
+		c.proxies = newEndpointSet(opts.QueryProxies)
+	}
+	return c, nil
 }
 
+// shouldClearRoute reports whether err means the cached routes of the request may be outdated.
 func shouldClearRoute(err error) bool {
-	if err != nil {
-		if unwrapErr, ok := err.(*Error); ok && unwrapErr.ShouldClearRoute() {
-			return true
-		} else if strings.Contains(err.Error(), "connection error") {
-			// TODO: Find a better way to check if err means remote endpoint is down.
-			return true
-		}
-	}
+	return errors.Is(err, ErrInvalidRoute) || errors.Is(err, ErrUnavailable)
+}
+
+// isEndpointUnavailable reports whether err means the remote endpoint can't be reached.
+func isEndpointUnavailable(err error) bool {
+	return errors.Is(err, ErrUnavailable)
+}
 
-	return false
+// clearRouteOnError drops the routes of the tables and reports the endpoint if err means they are outdated.
+func (c *clientImpl) clearRouteOnError(reqCtx RequestContext, endpoint string, tables []string, err error) {
+	if !shouldClearRoute(err) {
+		return
+	}
+	c.routeClient.ClearRouteFor(reqCtx, tables)
+	if isEndpointUnavailable(err) {
+		c.routeClient.ReportUnavailable(endpoint)
+	}
 }
 
 func (c *clientImpl) SQLQuery(ctx context.Context, req SQLQueryRequest) (SQLQueryResponse, error) {
+	if err := c.acquire(); err != nil {
+		return SQLQueryResponse{}, err
+	}
+	defer c.release()
+
 	if err := c.withDefaultRequestContext(&req.ReqCtx); err != nil {
 		return SQLQueryResponse{}, errors.Wrap(err, "add request ctx")
 	}
 
+	if len(req.Tables) == 0 {
+		req.Tables = ExtractTables(req.SQL)
+	}
 	if len(req.Tables) == 0 {
 		return SQLQueryResponse{}, ErrNullRequestTables
 	}
 
-	routes, err := c.routeClient.RouteFor(req.ReqCtx, req.Tables)
-	if err != nil {
-		return SQLQueryResponse{}, errors.Wrapf(err, "route tables failed, names:%v", req.Tables)
+	retryPolicy := c.rpcClient.opts.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		resp, err := c.sqlQueryOnce(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !retryPolicy.canRetry(attempt, err) {
+			return SQLQueryResponse{}, err
+		}
+		if err := sleepWithContext(ctx, retryPolicy.backoff(attempt)); err != nil {
+			return SQLQueryResponse{}, errors.Wrap(err, "wait for query retry")
+		}
 	}
+}
 
-	var endpoint string
-	if v, ok := routes[req.Tables[0]]; ok {
-		endpoint = v.Endpoint
-	} else {
-		return SQLQueryResponse{}, errors.Wrapf(ErrEmptyRoute, "failed to route table, name:%s", req.Tables[0])
+func (c *clientImpl) sqlQueryOnce(ctx context.Context, req SQLQueryRequest) (SQLQueryResponse, error) {
+	groups, err := c.routeTableGroups(ctx, req.ReqCtx, req.Tables)
+	if err != nil {
+		return SQLQueryResponse{}, err
+	}
+	if len(groups) > 1 {
+		return c.sqlQuerySplitRoutes(ctx, req, groups)
 	}
 
+	endpoint := groups[0].endpoint
 	resp, err := c.rpcClient.SQLQuery(ctx, endpoint, req)
 	if err != nil {
-		if shouldClearRoute(err) {
-			c.routeClient.ClearRouteFor(req.Tables)
-		}
-
+		c.clearRouteOnError(req.ReqCtx, endpoint, req.Tables, err)
 		return SQLQueryResponse{}, errors.Wrap(err, "do grpc query")
 	}
 
@@ -90,6 +131,11 @@ func (c *clientImpl) SQLQuery(ctx context.Context, req SQLQueryRequest) (SQLQuer
 }
 
 func (c *clientImpl) Write(ctx context.Context, req WriteRequest) (WriteResponse, error) {
+	if err := c.acquire(); err != nil {
+		return WriteResponse{}, err
+	}
+	defer c.release()
+
 	if err := c.withDefaultRequestContext(&req.ReqCtx); err != nil {
 		return WriteResponse{}, errors.Wrap(err, "add request ctx")
 	}
@@ -98,40 +144,139 @@ func (c *clientImpl) Write(ctx context.Context, req WriteRequest) (WriteResponse
 		return WriteResponse{}, ErrNullRows
 	}
 
-	tables := getTablesFromPoints(req.Points)
-	routes, err := c.routeClient.RouteFor(req.ReqCtx, tables)
-	if err != nil {
-		return WriteResponse{}, errors.Wrap(err, "route table")
-	}
+	ret := WriteResponse{}
+	retryPolicy := c.rpcClient.opts.RetryPolicy
+	pending := req.Points
+	for attempt := 1; len(pending) > 0; attempt++ {
+		if err := c.limiter.wait(ctx, pending); err != nil {
+			if attempt == 1 {
+				return WriteResponse{}, err
+			}
+			ret = combineWriteResponse(ret, failedWriteResponse("", pending, err))
+			break
+		}
 
-	pointsByRoute, err := splitPointsByRoute(req.Points, routes)
-	if err != nil {
-		return WriteResponse{}, errors.Wrap(err, "split points by route")
-	}
+		tables := getTablesFromPoints(pending)
+		routes, err := c.routeClient.RouteFor(ctx, req.ReqCtx, tables)
+		if err != nil {
+			if attempt == 1 {
+				return WriteResponse{}, errors.Wrap(err, "route table")
+			}
+			ret = combineWriteResponse(ret, failedWriteResponse("", pending, err))
+			break
+		}
 
-	// TODO(chenxiang): Convert to parallel write
-	ret := WriteResponse{}
-	for endpoint, points := range pointsByRoute {
-		response, err := c.rpcClient.Write(ctx, endpoint, req.ReqCtx, points)
+		pointsByRoute, err := splitPointsByRoute(pending, routes)
 		if err != nil {
-			if shouldClearRoute(err) {
-				c.routeClient.ClearRouteFor(getTablesFromPoints(points))
+			if attempt == 1 {
+				return WriteResponse{}, errors.Wrap(err, "split points by route")
 			}
+			ret = combineWriteResponse(ret, failedWriteResponse("", pending, err))
+			break
+		}
+
+		// Only the sub-batches which failed with a retryable error are sent again.
+		var retryResults []endpointWriteResult
+		for _, result := range c.writeByRoute(ctx, req.ReqCtx, pointsByRoute) {
+			c.limiter.onResult(getTablesFromPoints(result.points), result.err)
+			if result.err != nil {
+				c.clearRouteOnError(req.ReqCtx, result.endpoint, getTablesFromPoints(result.points), result.err)
 
-			// Only return first error message now.
-			if ret.Message == "" {
-				ret.Message = err.Error()
+				if retryPolicy.canRetry(attempt, result.err) {
+					retryResults = append(retryResults, result)
+					continue
+				}
+
+				ret = combineWriteResponse(ret, failedWriteResponse(result.endpoint, result.points, result.err))
+				continue
 			}
-			ret = combineWriteResponse(ret, WriteResponse{Failed: uint32(len(points))})
-			continue
+
+			ret = combineWriteResponse(ret, result.response)
 		}
 
-		ret = combineWriteResponse(ret, response)
+		pending = nil
+		if len(retryResults) == 0 {
+			break
+		}
+		if err := sleepWithContext(ctx, retryPolicy.backoff(attempt)); err != nil {
+			for _, result := range retryResults {
+				ret = combineWriteResponse(ret, failedWriteResponse(result.endpoint, result.points, result.err))
+			}
+			break
+		}
+		for _, result := range retryResults {
+			pending = append(pending, result.points...)
+		}
 	}
 
+	if ctx.Err() != nil {
+		return ret, errors.Wrap(ctx.Err(), "write canceled")
+	}
 	return ret, nil
 }
 
+type endpointWriteResult struct {
+	endpoint string
+	points   []Point
+	response WriteResponse
+	err      error
+}
+
+// writeByRoute sends the points of every endpoint concurrently, at most WriteConcurrency requests at a time.
+// The points of an endpoint are split into several requests when they exceed the max request size.
+func (c *clientImpl) writeByRoute(ctx context.Context, reqCtx RequestContext, pointsByRoute map[string][]Point) []endpointWriteResult {
+	opts := c.rpcClient.opts
+	requests := make([]endpointWriteResult, 0, len(pointsByRoute))
+	for endpoint, points := range pointsByRoute {
+		for _, chunk := range splitPointsBySize(points, opts.MaxRequestPoints, opts.MaxRequestBytes) {
+			requests = append(requests, endpointWriteResult{endpoint: endpoint, points: chunk})
+		}
+	}
+
+	concurrency := opts.WriteConcurrency
+	if concurrency <= 0 || concurrency > len(requests) {
+		concurrency = len(requests)
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	results := make(chan endpointWriteResult, len(requests))
+	for _, request := range requests {
+		if ctx.Err() != nil {
+			request.err = ctx.Err()
+			results <- request
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			request.err = ctx.Err()
+			results <- request
+			continue
+		}
+
+		wg.Add(1)
+		go func(request endpointWriteResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			request.response, request.err = c.rpcClient.Write(ctx, request.endpoint, reqCtx, request.points)
+			results <- request
+		}(request)
+	}
+	wg.Wait()
+	close(results)
+
+	ret := make([]endpointWriteResult, 0, len(requests))
+	for result := range results {
+		ret = append(ret, result)
+	}
+	return ret
+}
+
 func (c *clientImpl) withDefaultRequestContext(reqCtx *RequestContext) error {
 	// use default
 	if reqCtx.Database == "" {
@@ -144,3 +289,60 @@ func (c *clientImpl) withDefaultRequestContext(reqCtx *RequestContext) error {
 	}
 	return nil
 }
+
+// cachedEndpoint returns the endpoint the table is routed to from the route cache, empty if it is unknown.
+// Proxies take turns between requests, so their tables have no fixed endpoint.
+func (c *clientImpl) cachedEndpoint(reqCtx RequestContext, table string) string {
+	routeClient, ok := c.routeClient.(*directRouteClient)
+	if !ok || c.withDefaultRequestContext(&reqCtx) != nil {
+		return ""
+	}
+	return routeClient.cachedEndpoint(reqCtx.Database, table)
+}
+
+// Close waits for the inflight requests and then closes all conns, requests started after Close fail with ErrClientClosed.
+// If ctx is done first, the conns are closed anyway and the remaining requests are canceled.
+func (c *clientImpl) Close(ctx context.Context) error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(drained)
+	}()
+
+	var drainErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		drainErr = errors.Wrap(ctx.Err(), "wait for inflight requests")
+	}
+
+	c.routeClient.Close()
+	if err := c.rpcClient.Close(); err != nil && drainErr == nil {
+		return errors.Wrap(err, "close grpc conns")
+	}
+	return drainErr
+}
+
+// acquire registers an inflight request, every successful acquire must be paired with a release.
+func (c *clientImpl) acquire() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.inflight.Add(1)
+	return nil
+}
+
+func (c *clientImpl) release() {
+	c.inflight.Done()
+}
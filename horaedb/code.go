@@ -20,32 +20,76 @@
 package horaedb
 
 import (
+	"context"
 	"errors"
 	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The classes of errors, every error returned by the client matches at most one of them with errors.Is.
+var (
+	ErrUnavailable      = errors.New("endpoint is unavailable")
+	ErrTimeout          = errors.New("request timeout")
+	ErrFlowControl      = errors.New("request is limited by flow control")
+	ErrInvalidRoute     = errors.New("route is invalid")
+	ErrServerInternal   = errors.New("server internal error")
+	ErrClientValidation = errors.New("invalid request")
+	ErrUnauthorized     = errors.New("request is not authorized")
 )
 
 var (
-	ErrNoDatabaseSelected  = errors.New("no database selected, you can use database in client initial options or WriteRequest/SqlQueryRequest")
-	ErrPointEmptyTable     = errors.New("point's table is not set")
-	ErrPointEmptyTimestamp = errors.New("point's timestamp is not set")
-	ErrPointEmptyTags      = errors.New("point's tags should not be empty")
-	ErrPointEmptyFields    = errors.New("point's fields should not be empty")
+	ErrNoDatabaseSelected  = newValidationError("no database selected, you can use database in client initial options or WriteRequest/SqlQueryRequest")
+	ErrPointEmptyTable     = newValidationError("point's table is not set")
+	ErrPointEmptyTimestamp = newValidationError("point's timestamp is not set")
+	ErrPointEmptyTags      = newValidationError("point's tags should not be empty")
+	ErrPointEmptyFields    = newValidationError("point's fields should not be empty")
+	ErrNullRouteTables     = newValidationError("null route tables")
+	ErrNullRequestTables   = newValidationError("null request tables")
+	ErrScanDest            = newValidationError("invalid scan destination")
+	ErrScanTypeMismatch    = newValidationError("column type mismatches scan field")
+	ErrMarshalType         = newValidationError("invalid type to marshal points")
 	ErrNullRows            = errors.New("null rows")
-	ErrNullRouteTables     = errors.New("null route tables")
-	ErrNullRequestTables   = errors.New("null request tables")
 	ErrEmptyRoute          = errors.New("empty route")
 	ErrOnlyArrowSupport    = errors.New("only arrow support now")
 	ErrResponseHeaderMiss  = errors.New("response header miss")
+	ErrBatchWriterClosed   = errors.New("batch writer is closed")
+	ErrBatchWriterFull     = errors.New("batch writer buffer is full")
+	ErrStreamWriterClosed  = errors.New("stream writer is closed")
+	ErrStreamBroken        = errors.New("write stream is broken")
+	ErrClientClosed        = errors.New("client is closed")
+	ErrNoEndpoints         = errors.New("no endpoints to connect")
+	ErrCircuitOpen         = errors.New("circuit breaker is open")
+	ErrRouteConflict       = errors.New("tables of the query route to different endpoints")
 )
 
 const (
 	codeSuccess      = 200
 	codeInvalidRoute = 302
 	codeShouldRetry  = 310
+	codeBadRequest   = 400
 	codeInternal     = 500
 	codeFlowControl  = 503
 )
 
+// validationError is a request rejected by the client before sending it, it matches ErrClientValidation.
+type validationError struct {
+	msg string
+}
+
+func newValidationError(msg string) error {
+	return &validationError{msg: msg}
+}
+
+func (e *validationError) Error() string {
+	return e.msg
+}
+
+func (e *validationError) Is(target error) bool {
+	return target == ErrClientValidation
+}
+
 type Error struct {
 	Code uint32
 	Err  string
@@ -55,11 +99,80 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("HoraeDB RPC failed, code:%d, err:%s", e.Code, e.Err)
 }
 
-// TODO: may retry in sdk while code is 302 or 310
+// ShouldRetry always reports false, it is kept for compatibility. The retry loop of the client doesn't use
+// it, retries are decided by the RetryPolicy of WithRetryPolicy.
 func (e *Error) ShouldRetry() bool {
 	return false
 }
 
+// Is classifies the error by its HoraeDB code.
+func (e *Error) Is(target error) bool {
+	switch {
+	case e.Code == codeInvalidRoute:
+		return target == ErrInvalidRoute
+	case e.Code == codeFlowControl:
+		return target == ErrFlowControl
+	case e.Code >= codeBadRequest && e.Code < codeInternal:
+		return target == ErrClientValidation
+	case e.Code >= codeInternal:
+		return target == ErrServerInternal
+	default:
+		return false
+	}
+}
+
 func (e *Error) ShouldClearRoute() bool {
 	return e.Code == codeInvalidRoute
 }
+
+// GRPCError is an RPC that failed in gRPC, before HoraeDB could answer it.
+type GRPCError struct {
+	Code codes.Code
+	Err  error
+}
+
+func (e *GRPCError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GRPCError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus keeps status.FromError working on the error.
+func (e *GRPCError) GRPCStatus() *status.Status {
+	return status.Convert(e.Err)
+}
+
+// Is classifies the error by its gRPC code, canceled and timed out RPCs also match the errors of context.
+func (e *GRPCError) Is(target error) bool {
+	switch e.Code {
+	case codes.Unavailable:
+		return target == ErrUnavailable
+	case codes.DeadlineExceeded:
+		return target == ErrTimeout || target == context.DeadlineExceeded
+	case codes.Canceled:
+		return target == context.Canceled
+	case codes.ResourceExhausted:
+		return target == ErrFlowControl
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return target == ErrClientValidation
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return target == ErrUnauthorized
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+		return target == ErrServerInternal
+	default:
+		return false
+	}
+}
+
+// convertGRPCError wraps the gRPC status errors into a GRPCError, the others are returned as they are.
+func convertGRPCError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); !ok {
+		return err
+	}
+	return &GRPCError{Code: status.Code(err), Err: err}
+}
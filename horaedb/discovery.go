@@ -0,0 +1,258 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Discoverer finds the endpoints of HoraeDB. It is polled by the client, the endpoints are the seeds
+// of route discovery in Direct mode and the proxies in Proxy mode.
+type Discoverer interface {
+	Discover(context.Context) ([]string, error)
+}
+
+// DiscovererFunc adapts a function to a Discoverer.
+type DiscovererFunc func(context.Context) ([]string, error)
+
+func (f DiscovererFunc) Discover(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+type dnsDiscoverer struct {
+	resolver *net.Resolver
+	host     string
+	port     int
+}
+
+// NewDNSDiscoverer resolves the A/AAAA records of host, every address is an endpoint on port.
+func NewDNSDiscoverer(host string, port int) Discoverer {
+	return &dnsDiscoverer{
+		resolver: net.DefaultResolver,
+		host:     host,
+		port:     port,
+	}
+}
+
+func (d *dnsDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	addrs, err := d.resolver.LookupHost(ctx, d.host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lookup host, host:%s", d.host)
+	}
+
+	endpoints := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		endpoints = append(endpoints, net.JoinHostPort(addr, strconv.Itoa(d.port)))
+	}
+	return endpoints, nil
+}
+
+type dnsSRVDiscoverer struct {
+	resolver *net.Resolver
+	service  string
+	proto    string
+	name     string
+}
+
+// NewDNSSRVDiscoverer resolves the SRV records of _service._proto.name, see net.LookupSRV.
+// Empty service and proto look up name directly.
+func NewDNSSRVDiscoverer(service, proto, name string) Discoverer {
+	return &dnsSRVDiscoverer{
+		resolver: net.DefaultResolver,
+		service:  service,
+		proto:    proto,
+		name:     name,
+	}
+}
+
+func (d *dnsSRVDiscoverer) Discover(ctx context.Context) ([]string, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, d.service, d.proto, d.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "lookup srv, name:%s", d.name)
+	}
+
+	endpoints := make([]string, 0, len(records))
+	for _, record := range records {
+		host := strings.TrimSuffix(record.Target, ".")
+		endpoints = append(endpoints, net.JoinHostPort(host, strconv.Itoa(int(record.Port))))
+	}
+	return endpoints, nil
+}
+
+type fileDiscoverer struct {
+	path string
+
+	mutex     sync.Mutex
+	modTime   time.Time
+	endpoints []string
+}
+
+// NewFileDiscoverer reads the endpoints from a JSON or YAML file, chosen by the extension of path, and
+// reads it again whenever it is modified. The file holds either a list of endpoints or an object with
+// an "endpoints" list.
+func NewFileDiscoverer(path string) Discoverer {
+	return &fileDiscoverer{
+		path: path,
+	}
+}
+
+type endpointsFile struct {
+	Endpoints []string `json:"endpoints" yaml:"endpoints"`
+}
+
+func (d *fileDiscoverer) Discover(context.Context) ([]string, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	info, err := os.Stat(d.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "stat endpoints file, path:%s", d.path)
+	}
+	if d.endpoints != nil && info.ModTime().Equal(d.modTime) {
+		return d.endpoints, nil
+	}
+
+	content, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "read endpoints file, path:%s", d.path)
+	}
+	endpoints, err := parseEndpointsFile(d.path, content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parse endpoints file, path:%s", d.path)
+	}
+
+	d.modTime = info.ModTime()
+	d.endpoints = endpoints
+	return endpoints, nil
+}
+
+func parseEndpointsFile(path string, content []byte) ([]string, error) {
+	unmarshal := json.Unmarshal
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		unmarshal = yaml.Unmarshal
+	case ".json":
+	default:
+		return nil, fmt.Errorf("unsupported endpoints file type:%s", filepath.Ext(path))
+	}
+
+	var list []string
+	if err := unmarshal(content, &list); err == nil {
+		return nonNilEndpoints(list), nil
+	}
+
+	var file endpointsFile
+	if err := unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+	return nonNilEndpoints(file.Endpoints), nil
+}
+
+// nonNilEndpoints keeps an empty file distinguishable from a file which is not read yet.
+func nonNilEndpoints(endpoints []string) []string {
+	if endpoints == nil {
+		return []string{}
+	}
+	return endpoints
+}
+
+// endpointWatcher polls the discoverer and updates the endpoints, a failed or empty discovery keeps the old ones.
+type endpointWatcher struct {
+	opts      options
+	endpoints *endpointSet
+	onRemoved func(endpoint string)
+
+	stopCh  chan struct{}
+	stopped chan struct{}
+}
+
+func startEndpointWatcher(endpoints *endpointSet, opts options, onRemoved func(endpoint string)) *endpointWatcher {
+	w := &endpointWatcher{
+		opts:      opts,
+		endpoints: endpoints,
+		onRemoved: onRemoved,
+		stopCh:    make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go w.watch()
+	return w
+}
+
+func (w *endpointWatcher) watch() {
+	defer close(w.stopped)
+
+	if w.opts.DiscoveryInterval <= 0 {
+		<-w.stopCh
+		return
+	}
+
+	ticker := time.NewTicker(w.opts.DiscoveryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := w.refresh(); err != nil && w.opts.LoggerDebug {
+				_, _ = w.opts.Logger.Write([]byte(fmt.Sprintf("Discover endpoints failed, err:%v\n", err)))
+			}
+		case <-w.stopCh:
+			return
+		}
+	}
+}
+
+func (w *endpointWatcher) refresh() error {
+	endpoints, err := discoverEndpoints(w.opts)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return errors.Wrap(ErrNoEndpoints, "discover endpoints")
+	}
+	for _, endpoint := range w.endpoints.update(endpoints) {
+		w.onRemoved(endpoint)
+	}
+	return nil
+}
+
+func (w *endpointWatcher) stop() {
+	if w == nil {
+		return
+	}
+	close(w.stopCh)
+	<-w.stopped
+}
+
+func discoverEndpoints(opts options) ([]string, error) {
+	ctx, cancel := withDefaultTimeout(context.Background(), opts.RouteTimeout)
+	defer cancel()
+	return opts.Discoverer.Discover(ctx)
+}
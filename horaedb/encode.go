@@ -0,0 +1,337 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Marshaler is implemented by types which encode themselves into a Value of a tag or field.
+type Marshaler interface {
+	MarshalHoraeDB() (Value, error)
+}
+
+var (
+	valueType     = reflect.TypeOf(Value{})
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+	encodePlans sync.Map // reflect.Type -> *encodePlan
+)
+
+type columnKind int
+
+const (
+	columnTag columnKind = iota
+	columnField
+	columnTimestamp
+)
+
+type encodeColumn struct {
+	name   string
+	kind   columnKind
+	index  []int
+	encode func(reflect.Value) (Value, error)
+}
+
+// encodePlan is the reflection metadata of a struct type, built once per type.
+type encodePlan struct {
+	columns []encodeColumn
+}
+
+// PointEncoder encodes structs into the points of a table, by the struct tags of their fields:
+//
+//	type Metric struct {
+//		Host  string    `horaedb:"host,tag"`
+//		Value float64   `horaedb:"value,field"`
+//		Time  time.Time `horaedb:",timestamp"`
+//	}
+//
+// An empty name falls back to the name of the struct field, and fields without a horaedb tag are ignored.
+// The timestamp is a time.Time or an integer of milliseconds. The Value type of a tag or field is inferred
+// from the Go type: integers and floats of every width, bool, string, []byte, time.Time, Value and Marshaler,
+// and a nil pointer of them is a null value, so is a zero time.Time. Tags must be strings.
+type PointEncoder struct {
+	table string
+}
+
+func NewPointEncoder(table string) *PointEncoder {
+	return &PointEncoder{
+		table: table,
+	}
+}
+
+// Encode encodes a struct or a pointer to struct into a point.
+func (e *PointEncoder) Encode(v interface{}) (Point, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return Point{}, errors.Wrapf(ErrMarshalType, "nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return Point{}, errors.Wrapf(ErrMarshalType, "want struct, got %T", v)
+	}
+
+	plan, err := encodePlanOf(rv.Type())
+	if err != nil {
+		return Point{}, err
+	}
+	return plan.encode(e.table, rv)
+}
+
+// EncodeAll encodes a slice of structs or of pointers to structs into points.
+func (e *PointEncoder) EncodeAll(v interface{}) ([]Point, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, errors.Wrapf(ErrMarshalType, "want slice, got %T", v)
+	}
+
+	points := make([]Point, 0, rv.Len())
+	for idx := 0; idx < rv.Len(); idx++ {
+		point, err := e.Encode(rv.Index(idx).Interface())
+		if err != nil {
+			return nil, errors.Wrapf(err, "encode element %d", idx)
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// MarshalPoints encodes a slice of structs into points of the table, see PointEncoder for the struct tags.
+func MarshalPoints(table string, v interface{}) ([]Point, error) {
+	return NewPointEncoder(table).EncodeAll(v)
+}
+
+func (p *encodePlan) encode(table string, v reflect.Value) (Point, error) {
+	builder := NewPointBuilder(table)
+	for _, column := range p.columns {
+		field := v.FieldByIndex(column.index)
+		if column.kind == columnTimestamp {
+			builder.SetTimestamp(timestampOf(field))
+			continue
+		}
+
+		value, err := column.encode(field)
+		if err != nil {
+			return Point{}, errors.Wrapf(err, "encode column %s", column.name)
+		}
+		if column.kind == columnTag {
+			if !value.IsNull() && value.DataType() != STRING {
+				return Point{}, errors.Wrapf(ErrMarshalType, "tag %s is %s, not STRING", column.name, value.DataType())
+			}
+			builder.AddTag(column.name, value)
+		} else {
+			builder.AddField(column.name, value)
+		}
+	}
+	return builder.Build()
+}
+
+func timestampOf(v reflect.Value) int64 {
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.IsZero() {
+			return 0
+		}
+		return t.UnixMilli()
+	}
+	if v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64 {
+		return int64(v.Uint())
+	}
+	return v.Int()
+}
+
+func encodePlanOf(typ reflect.Type) (*encodePlan, error) {
+	if plan, ok := encodePlans.Load(typ); ok {
+		return plan.(*encodePlan), nil
+	}
+
+	plan := &encodePlan{}
+	hasTimestamp := false
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		tag, ok := field.Tag.Lookup(structTagName)
+		if !ok || tag == "-" || field.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.Split(tag, ",")
+		column := encodeColumn{
+			name:  parts[0],
+			kind:  columnField,
+			index: field.Index,
+		}
+		if column.name == "" {
+			column.name = field.Name
+		}
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "tag":
+				column.kind = columnTag
+			case "field":
+			case "timestamp":
+				column.kind = columnTimestamp
+			default:
+				return nil, errors.Wrapf(ErrMarshalType, "unknown option %q of field %s.%s", parts[1], typ, field.Name)
+			}
+		}
+
+		if column.kind == columnTimestamp {
+			if hasTimestamp {
+				return nil, errors.Wrapf(ErrMarshalType, "more than one timestamp in %s", typ)
+			}
+			if !isTimestampType(field.Type) {
+				return nil, errors.Wrapf(ErrMarshalType, "timestamp %s.%s is %s, want time.Time or integer", typ, field.Name, field.Type)
+			}
+			hasTimestamp = true
+		} else {
+			encode, err := valueEncoderOf(field.Type)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %s.%s", typ, field.Name)
+			}
+			column.encode = encode
+		}
+		plan.columns = append(plan.columns, column)
+	}
+	if !hasTimestamp {
+		return nil, errors.Wrapf(ErrMarshalType, "no timestamp in %s", typ)
+	}
+
+	actual, _ := encodePlans.LoadOrStore(typ, plan)
+	return actual.(*encodePlan), nil
+}
+
+func isTimestampType(typ reflect.Type) bool {
+	if typ == timeType {
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// valueEncoderOf infers the Value type from the Go type.
+func valueEncoderOf(typ reflect.Type) (func(reflect.Value) (Value, error), error) {
+	if typ.Implements(marshalerType) {
+		return func(v reflect.Value) (Value, error) {
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				return Value{}, nil
+			}
+			return v.Interface().(Marshaler).MarshalHoraeDB()
+		}, nil
+	}
+	if reflect.PtrTo(typ).Implements(marshalerType) {
+		return func(v reflect.Value) (Value, error) {
+			if v.CanAddr() {
+				return v.Addr().Interface().(Marshaler).MarshalHoraeDB()
+			}
+			ptr := reflect.New(typ)
+			ptr.Elem().Set(v)
+			return ptr.Interface().(Marshaler).MarshalHoraeDB()
+		}, nil
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		elemEncode, err := valueEncoderOf(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		null, err := nullValueOf(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) (Value, error) {
+			if v.IsNil() {
+				return null, nil
+			}
+			return elemEncode(v.Elem())
+		}, nil
+	}
+
+	switch {
+	case typ == valueType:
+		return func(v reflect.Value) (Value, error) { return v.Interface().(Value), nil }, nil
+	case typ == timeType:
+		return func(v reflect.Value) (Value, error) {
+			t := v.Interface().(time.Time)
+			if t.IsZero() {
+				return NewTimestampNullValue(), nil
+			}
+			return NewTimestampValue(t.UnixMilli()), nil
+		}, nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return func(v reflect.Value) (Value, error) { return NewVarbinaryValue(v.Bytes()), nil }, nil
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		return func(v reflect.Value) (Value, error) { return NewStringValue(v.String()), nil }, nil
+	case reflect.Bool:
+		return func(v reflect.Value) (Value, error) { return NewBoolValue(v.Bool()), nil }, nil
+	case reflect.Float64:
+		return func(v reflect.Value) (Value, error) { return NewDoubleValue(v.Float()), nil }, nil
+	case reflect.Float32:
+		return func(v reflect.Value) (Value, error) { return NewFloatValue(float32(v.Float())), nil }, nil
+	case reflect.Int, reflect.Int64:
+		return func(v reflect.Value) (Value, error) { return NewInt64Value(v.Int()), nil }, nil
+	case reflect.Int32:
+		return func(v reflect.Value) (Value, error) { return NewInt32Value(int32(v.Int())), nil }, nil
+	case reflect.Int16:
+		return func(v reflect.Value) (Value, error) { return NewInt16Value(int16(v.Int())), nil }, nil
+	case reflect.Int8:
+		return func(v reflect.Value) (Value, error) { return NewInt8Value(int8(v.Int())), nil }, nil
+	case reflect.Uint, reflect.Uint64:
+		return func(v reflect.Value) (Value, error) { return NewUint64Value(v.Uint()), nil }, nil
+	case reflect.Uint32:
+		return func(v reflect.Value) (Value, error) { return NewUint32Value(uint32(v.Uint())), nil }, nil
+	case reflect.Uint16:
+		return func(v reflect.Value) (Value, error) { return NewUint16Value(uint16(v.Uint())), nil }, nil
+	case reflect.Uint8:
+		return func(v reflect.Value) (Value, error) { return NewUint8Value(uint8(v.Uint())), nil }, nil
+	default:
+		return nil, errors.Wrapf(ErrMarshalType, "unsupported type %s", typ)
+	}
+}
+
+// nullValueOf returns the null Value of the type inferred from the Go type.
+func nullValueOf(typ reflect.Type) (Value, error) {
+	encode, err := valueEncoderOf(typ)
+	if err != nil {
+		return Value{}, err
+	}
+	if typ.Implements(marshalerType) || reflect.PtrTo(typ).Implements(marshalerType) || typ == valueType {
+		// The type of a custom value is unknown until it is marshaled.
+		return Value{}, nil
+	}
+	value, err := encode(reflect.Zero(typ))
+	if err != nil {
+		return Value{}, err
+	}
+	return Value{dataType: value.DataType()}, nil
+}
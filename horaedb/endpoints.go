@@ -0,0 +1,168 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	endpointMinDownTime = time.Second
+	endpointMaxDownTime = 30 * time.Second
+)
+
+// endpointSet is the list of seed or proxy endpoints, an endpoint is skipped for a while after it fails.
+type endpointSet struct {
+	mutex     sync.Mutex
+	endpoints []*endpointHealth
+	next      int
+}
+
+type endpointHealth struct {
+	endpoint  string
+	failures  int
+	downUntil time.Time
+}
+
+func newEndpointSet(endpoints []string) *endpointSet {
+	s := &endpointSet{}
+	s.update(endpoints)
+	return s
+}
+
+// update replaces the endpoints and returns the removed ones, the health of the endpoints which are kept
+// is not reset.
+func (s *endpointSet) update(endpoints []string) (removed []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	old := make(map[string]*endpointHealth, len(s.endpoints))
+	for _, e := range s.endpoints {
+		old[e.endpoint] = e
+	}
+
+	s.endpoints = make([]*endpointHealth, 0, len(endpoints))
+	seen := make(map[string]struct{}, len(endpoints))
+	for _, endpoint := range endpoints {
+		if _, ok := seen[endpoint]; ok || endpoint == "" {
+			continue
+		}
+		seen[endpoint] = struct{}{}
+
+		if e, ok := old[endpoint]; ok {
+			s.endpoints = append(s.endpoints, e)
+			delete(old, endpoint)
+		} else {
+			s.endpoints = append(s.endpoints, &endpointHealth{endpoint: endpoint})
+		}
+	}
+
+	for endpoint := range old {
+		removed = append(removed, endpoint)
+	}
+	return removed
+}
+
+// ordered returns all the endpoints in round-robin order, the healthy ones first.
+func (s *endpointSet) ordered() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	n := len(s.endpoints)
+	if n == 0 {
+		return nil
+	}
+	start := s.next % n
+	s.next = (start + 1) % n
+
+	now := time.Now()
+	healthy := make([]string, 0, n)
+	var down []string
+	for i := 0; i < n; i++ {
+		e := s.endpoints[(start+i)%n]
+		if now.Before(e.downUntil) {
+			down = append(down, e.endpoint)
+		} else {
+			healthy = append(healthy, e.endpoint)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// pick returns the next endpoint in round-robin order, it is empty only when there is no endpoint.
+func (s *endpointSet) pick() string {
+	endpoints := s.ordered()
+	if len(endpoints) == 0 {
+		return ""
+	}
+	return endpoints[0]
+}
+
+func (s *endpointSet) contains(endpoint string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.endpoints {
+		if e.endpoint == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// markFailure takes the endpoint down, the down time doubles with every consecutive failure.
+func (s *endpointSet) markFailure(endpoint string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.endpoints {
+		if e.endpoint != endpoint {
+			continue
+		}
+		e.failures++
+		downTime := endpointMinDownTime << uint(minInt(e.failures-1, 5))
+		if downTime > endpointMaxDownTime {
+			downTime = endpointMaxDownTime
+		}
+		e.downUntil = time.Now().Add(downTime)
+		return
+	}
+}
+
+func (s *endpointSet) markSuccess(endpoint string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.endpoints {
+		if e.endpoint == endpoint {
+			e.failures = 0
+			e.downUntil = time.Time{}
+			return
+		}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
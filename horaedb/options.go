@@ -20,8 +20,12 @@
 package horaedb
 
 import (
+	"crypto/tls"
 	"io"
 	"os"
+	"time"
+
+	"google.golang.org/grpc/credentials"
 )
 
 type Option interface {
@@ -29,11 +33,32 @@ type Option interface {
 }
 
 type options struct {
-	Database          string
-	Logger            io.Writer
-	LoggerDebug       bool
-	RPCMaxRecvMsgSize int
-	RouteMaxCacheSize int
+	Database           string
+	Logger             io.Writer
+	LoggerDebug        bool
+	RPCMaxRecvMsgSize  int
+	RouteMaxCacheSize  int
+	WriteConcurrency   int
+	RetryPolicy        RetryPolicy
+	TLS                tlsOptions
+	PerRPCCredentials  credentials.PerRPCCredentials
+	Metadata           map[string]string
+	ConnIdleTimeout    time.Duration
+	RouteTimeout       time.Duration
+	WriteTimeout       time.Duration
+	QueryTimeout       time.Duration
+	RouteBatchWindow   time.Duration
+	RouteTTL           time.Duration
+	Discoverer         Discoverer
+	DiscoveryInterval  time.Duration
+	BreakerThreshold   int
+	BreakerOpenTimeout time.Duration
+	RateLimit          RateLimit
+	TableRateLimits    map[string]RateLimit
+	MaxRequestPoints   int
+	MaxRequestBytes    int
+	QueryProxies       []string
+	TimestampDataType  bool
 }
 
 type funcOption struct {
@@ -52,11 +77,24 @@ func newFuncOption(f func(*options)) *funcOption {
 
 func defaultOptions() *options {
 	return &options{
-		Database:          "",
-		Logger:            os.Stdout,
-		LoggerDebug:       false,
-		RPCMaxRecvMsgSize: 1024 * 1024 * 1024,
-		RouteMaxCacheSize: 10 * 1000,
+		Database:           "",
+		Logger:             os.Stdout,
+		LoggerDebug:        false,
+		RPCMaxRecvMsgSize:  1024 * 1024 * 1024,
+		RouteMaxCacheSize:  10 * 1000,
+		WriteConcurrency:   8,
+		RetryPolicy:        noRetryPolicy(),
+		ConnIdleTimeout:    5 * time.Minute,
+		RouteTimeout:       10 * time.Second,
+		WriteTimeout:       0,
+		QueryTimeout:       0,
+		RouteBatchWindow:   0,
+		RouteTTL:           0,
+		DiscoveryInterval:  30 * time.Second,
+		BreakerThreshold:   0,
+		BreakerOpenTimeout: 5 * time.Second,
+		MaxRequestPoints:   0,
+		MaxRequestBytes:    0,
 	}
 }
 
@@ -89,3 +127,183 @@ func WithRouteMaxCacheSize(size int) Option {
 		o.RouteMaxCacheSize = size
 	})
 }
+
+// WithWriteConcurrency limits how many write requests a single Write sends at the same time,
+// one makes the requests of a split write go one after another.
+func WithWriteConcurrency(concurrency int) Option {
+	return newFuncOption(func(o *options) {
+		o.WriteConcurrency = concurrency
+	})
+}
+
+// WithRetryPolicy enables retrying of Write and SQLQuery, see DefaultRetryPolicy for a reasonable start.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return newFuncOption(func(o *options) {
+		o.RetryPolicy = policy
+	})
+}
+
+// WithTLSConfig enables TLS with the given config, the other TLS options are applied on top of a clone of it.
+func WithTLSConfig(config *tls.Config) Option {
+	return newFuncOption(func(o *options) {
+		o.TLS.Config = config
+	})
+}
+
+// WithTLSCAFile enables TLS and verifies servers with the PEM CA bundle, which is reloaded when the file changes.
+func WithTLSCAFile(caFile string) Option {
+	return newFuncOption(func(o *options) {
+		o.TLS.CAFile = caFile
+	})
+}
+
+// WithTLSClientCertFile enables mutual TLS with the PEM certificate and key, which are reloaded when the files change.
+func WithTLSClientCertFile(certFile, keyFile string) Option {
+	return newFuncOption(func(o *options) {
+		o.TLS.CertFile = certFile
+		o.TLS.KeyFile = keyFile
+	})
+}
+
+// WithTLSServerName enables TLS and overrides the server name used to verify every endpoint.
+func WithTLSServerName(serverName string) Option {
+	return newFuncOption(func(o *options) {
+		o.TLS.ServerName = serverName
+	})
+}
+
+// WithPerRPCCredentials attaches the credentials to every RPC, see NewBearerTokenCredentials and NewBasicAuthCredentials.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return newFuncOption(func(o *options) {
+		o.PerRPCCredentials = creds
+	})
+}
+
+// WithMetadata attaches the gRPC metadata to every RPC, RequestContext.Metadata is added on top of it.
+func WithMetadata(md map[string]string) Option {
+	return newFuncOption(func(o *options) {
+		o.Metadata = md
+	})
+}
+
+// WithConnIdleTimeout closes the conn of an endpoint which has had no route and no RPC for the timeout, zero disables it.
+func WithConnIdleTimeout(timeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.ConnIdleTimeout = timeout
+	})
+}
+
+// WithRouteTimeout limits every Route RPC whose context has no deadline, zero means no limit.
+func WithRouteTimeout(timeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.RouteTimeout = timeout
+	})
+}
+
+// WithWriteTimeout limits every Write RPC whose context has no deadline, zero means no limit.
+func WithWriteTimeout(timeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.WriteTimeout = timeout
+	})
+}
+
+// WithQueryTimeout limits every SQLQuery RPC whose context has no deadline, zero means no limit.
+func WithQueryTimeout(timeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.QueryTimeout = timeout
+	})
+}
+
+// WithRouteBatchWindow merges the route misses arriving within the window into one Route RPC.
+// Zero, the default, sends every miss at once, and concurrent misses of the same tables still share one RPC.
+func WithRouteBatchWindow(window time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.RouteBatchWindow = window
+	})
+}
+
+// WithRouteTTL expires cached routes after the ttl, routes in use are refreshed in the background before
+// they expire, and an expired route is only used when refreshing it fails. Zero keeps routes until evicted.
+func WithRouteTTL(ttl time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.RouteTTL = ttl
+	})
+}
+
+// WithDiscoverer keeps the endpoints of the client up to date with the discoverer, see NewDNSDiscoverer,
+// NewDNSSRVDiscoverer and NewFileDiscoverer. The endpoints passed to NewClient are only used when the
+// first discovery fails. The query proxies of WithQueryProxyEndpoints are not discovered, they stay fixed.
+func WithDiscoverer(discoverer Discoverer) Option {
+	return newFuncOption(func(o *options) {
+		o.Discoverer = discoverer
+	})
+}
+
+// WithDiscoveryInterval sets how often the discoverer is polled, zero or negative only discovers once at start.
+func WithDiscoveryInterval(interval time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.DiscoveryInterval = interval
+	})
+}
+
+// WithMaxWriteRequestPoints splits the points of an endpoint into several write requests of at most max points,
+// zero means no limit.
+func WithMaxWriteRequestPoints(max int) Option {
+	return newFuncOption(func(o *options) {
+		o.MaxRequestPoints = max
+	})
+}
+
+// WithMaxWriteRequestBytes splits the points of an endpoint into several write requests of at most max estimated
+// bytes, zero means no limit and is the default. It should be below the max message size of the server, which
+// is 4MiB by default.
+func WithMaxWriteRequestBytes(max int) Option {
+	return newFuncOption(func(o *options) {
+		o.MaxRequestBytes = max
+	})
+}
+
+// WithWriteRateLimit limits the points and bytes of all writes. The rate is lowered when the server answers
+// with flow control errors, and recovers gradually with the following successful writes.
+func WithWriteRateLimit(limit RateLimit) Option {
+	return newFuncOption(func(o *options) {
+		o.RateLimit = limit
+	})
+}
+
+// WithTableWriteRateLimit limits the points and bytes written to the table, on top of WithWriteRateLimit.
+func WithTableWriteRateLimit(table string, limit RateLimit) Option {
+	return newFuncOption(func(o *options) {
+		if o.TableRateLimits == nil {
+			o.TableRateLimits = make(map[string]RateLimit)
+		}
+		o.TableRateLimits[table] = limit
+	})
+}
+
+// WithCircuitBreaker fails requests to an endpoint fast with a CircuitOpenError after threshold consecutive
+// failures, and probes the endpoint after openTimeout. A threshold of zero, the default, disables it.
+func WithCircuitBreaker(threshold int, openTimeout time.Duration) Option {
+	return newFuncOption(func(o *options) {
+		o.BreakerThreshold = threshold
+		o.BreakerOpenTimeout = openTimeout
+	})
+}
+
+// WithQueryProxyEndpoints sends the queries whose tables route to different endpoints to one of the proxies,
+// which must forward queries across the cluster, e.g. HoraeDB servers started as proxies. Without them such
+// a query is split into sub-queries per endpoint if it is a UNION ALL of scans, or fails with a RouteConflictError.
+// The proxies are fixed, the Discoverer of WithDiscoverer doesn't update them.
+func WithQueryProxyEndpoints(endpoints ...string) Option {
+	return newFuncOption(func(o *options) {
+		o.QueryProxies = endpoints
+	})
+}
+
+// WithTimestampDataType decodes the timestamp columns of query results as DataType TIMESTAMP, instead of
+// INT64 as before. The values are milliseconds either way.
+func WithTimestampDataType(enable bool) Option {
+	return newFuncOption(func(o *options) {
+		o.TimestampDataType = enable
+	})
+}
@@ -0,0 +1,274 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// tableGroup is the tables of a query which route to the same endpoint.
+type tableGroup struct {
+	endpoint string
+	tables   []string
+}
+
+// RouteConflictError is returned when the tables of a query route to different endpoints, and the query can
+// neither be sent to a query proxy nor split into sub-queries. It matches ErrRouteConflict with errors.Is.
+type RouteConflictError struct {
+	// Routes maps every endpoint to the tables routed to it.
+	Routes map[string][]string
+}
+
+func newRouteConflictError(groups []tableGroup) *RouteConflictError {
+	routes := make(map[string][]string, len(groups))
+	for _, group := range groups {
+		routes[group.endpoint] = group.tables
+	}
+	return &RouteConflictError{Routes: routes}
+}
+
+func (e *RouteConflictError) Error() string {
+	endpoints := make([]string, 0, len(e.Routes))
+	for endpoint := range e.Routes {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+
+	routes := make([]string, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		routes = append(routes, fmt.Sprintf("%s:%v", endpoint, e.Routes[endpoint]))
+	}
+	return fmt.Sprintf("%s, routes:%s", ErrRouteConflict.Error(), strings.Join(routes, " "))
+}
+
+func (e *RouteConflictError) Is(target error) bool {
+	return target == ErrRouteConflict
+}
+
+// routeTableGroups groups the tables by endpoint, in order of the first table of every endpoint. Every
+// table must have a route, otherwise ErrEmptyRoute is returned.
+func (c *clientImpl) routeTableGroups(ctx context.Context, reqCtx RequestContext, tables []string) ([]tableGroup, error) {
+	routes, err := c.routeClient.RouteFor(ctx, reqCtx, tables)
+	if err != nil {
+		return nil, errors.Wrapf(err, "route tables failed, names:%v", tables)
+	}
+
+	var groups []tableGroup
+	var unrouted []string
+	indexes := make(map[string]int)
+	for _, table := range tables {
+		route, ok := routes[table]
+		if !ok {
+			unrouted = append(unrouted, table)
+			continue
+		}
+		if idx, ok := indexes[route.Endpoint]; ok {
+			groups[idx].tables = append(groups[idx].tables, table)
+			continue
+		}
+		indexes[route.Endpoint] = len(groups)
+		groups = append(groups, tableGroup{endpoint: route.Endpoint, tables: []string{table}})
+	}
+	if len(unrouted) > 0 {
+		return nil, errors.Wrapf(ErrEmptyRoute, "failed to route tables, names:%v", unrouted)
+	}
+	return groups, nil
+}
+
+// sqlQuerySplitRoutes serves a query whose tables route to different endpoints by a query proxy if there is
+// one, otherwise by a sub-query to every endpoint if the query is a UNION ALL of queries of one endpoint each.
+func (c *clientImpl) sqlQuerySplitRoutes(ctx context.Context, req SQLQueryRequest, groups []tableGroup) (SQLQueryResponse, error) {
+	if c.proxies != nil {
+		endpoint := c.proxies.pick()
+		resp, err := c.rpcClient.SQLQuery(ctx, endpoint, req)
+		c.markProxyResult(endpoint, err)
+		if err != nil {
+			return SQLQueryResponse{}, errors.Wrapf(err, "do grpc query by proxy, endpoint:%s", endpoint)
+		}
+		return resp, nil
+	}
+
+	subQueries, ok, err := c.planSubQueries(ctx, req)
+	if err != nil {
+		return SQLQueryResponse{}, err
+	}
+	if !ok {
+		return SQLQueryResponse{}, newRouteConflictError(groups)
+	}
+	return c.sqlQuerySubQueries(ctx, req, subQueries)
+}
+
+// markProxyResult takes a query proxy down for a while when it is unavailable.
+func (c *clientImpl) markProxyResult(endpoint string, err error) {
+	switch {
+	case err == nil:
+		c.proxies.markSuccess(endpoint)
+	case isEndpointUnavailable(err):
+		c.proxies.markFailure(endpoint)
+	}
+}
+
+type subQuery struct {
+	endpoint string
+	req      SQLQueryRequest
+}
+
+// planSubQueries merges the queries of a UNION ALL by endpoint. ok is false if the sql is not a UNION ALL,
+// or one of its queries reads no table, a table without route or tables of different endpoints.
+func (c *clientImpl) planSubQueries(ctx context.Context, req SQLQueryRequest) ([]subQuery, bool, error) {
+	queries, ok := splitUnionAll(req.SQL)
+	if !ok {
+		return nil, false, nil
+	}
+
+	queryTables := make([][]string, len(queries))
+	var tables []string
+	for idx, query := range queries {
+		queryTables[idx] = ExtractTables(query)
+		if len(queryTables[idx]) == 0 {
+			return nil, false, nil
+		}
+		tables = append(tables, queryTables[idx]...)
+	}
+	routes, err := c.routeClient.RouteFor(ctx, req.ReqCtx, tables)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "route tables failed, names:%v", tables)
+	}
+
+	var subQueries []subQuery
+	indexes := make(map[string]int)
+	for idx, query := range queries {
+		endpoint := ""
+		for _, table := range queryTables[idx] {
+			route, ok := routes[table]
+			if !ok || (endpoint != "" && route.Endpoint != endpoint) {
+				return nil, false, nil
+			}
+			endpoint = route.Endpoint
+		}
+
+		if i, ok := indexes[endpoint]; ok {
+			sub := &subQueries[i]
+			sub.req.SQL += " UNION ALL " + query
+			for _, table := range queryTables[idx] {
+				if !containsString(sub.req.Tables, table) {
+					sub.req.Tables = append(sub.req.Tables, table)
+				}
+			}
+			continue
+		}
+		indexes[endpoint] = len(subQueries)
+		subQueries = append(subQueries, subQuery{
+			endpoint: endpoint,
+			req: SQLQueryRequest{
+				ReqCtx: req.ReqCtx,
+				Tables: queryTables[idx],
+				SQL:    query,
+			},
+		})
+	}
+	return subQueries, true, nil
+}
+
+// sqlQuerySubQueries sends the sub-queries concurrently and merges their results.
+func (c *clientImpl) sqlQuerySubQueries(ctx context.Context, req SQLQueryRequest, subQueries []subQuery) (SQLQueryResponse, error) {
+	responses := make([]SQLQueryResponse, len(subQueries))
+	errs := make([]error, len(subQueries))
+	var wg sync.WaitGroup
+	for idx, sub := range subQueries {
+		wg.Add(1)
+		go func(idx int, sub subQuery) {
+			defer wg.Done()
+			responses[idx], errs[idx] = c.rpcClient.SQLQuery(ctx, sub.endpoint, sub.req)
+		}(idx, sub)
+	}
+	wg.Wait()
+
+	// A sub-query without rows is empty in the merged result, only all of them empty is ErrNullRows.
+	nullRows := 0
+	for idx, err := range errs {
+		if errors.Is(err, ErrNullRows) {
+			nullRows++
+			errs[idx] = nil
+		}
+	}
+	if nullRows == len(subQueries) {
+		return SQLQueryResponse{}, ErrNullRows
+	}
+
+	var firstErr error
+	for idx, err := range errs {
+		if err == nil {
+			continue
+		}
+		sub := subQueries[idx]
+		c.clearRouteOnError(sub.req.ReqCtx, sub.endpoint, sub.req.Tables, err)
+		if firstErr == nil {
+			firstErr = errors.Wrapf(err, "do grpc sub-query, endpoint:%s", sub.endpoint)
+		}
+	}
+	if firstErr != nil {
+		return SQLQueryResponse{}, firstErr
+	}
+	return mergeQueryResponses(req.SQL, responses)
+}
+
+// mergeQueryResponses puts the rows of the sub-queries together, their columns must have the same names and types.
+func mergeQueryResponses(sql string, responses []SQLQueryResponse) (SQLQueryResponse, error) {
+	merged := SQLQueryResponse{
+		SQL: sql,
+	}
+	for idx, resp := range responses {
+		merged.AffectedRows += resp.AffectedRows
+		merged.Rows = append(merged.Rows, resp.Rows...)
+		if len(resp.Schema) == 0 {
+			continue
+		}
+		if merged.Schema == nil {
+			merged.Schema = append([]ColumnSchema(nil), resp.Schema...)
+			continue
+		}
+		if !sameColumnTypes(merged.Schema, resp.Schema) {
+			return SQLQueryResponse{}, errors.Errorf("columns of sub-query %d mismatch, expect:%v, actual:%v", idx, merged.Schema, resp.Schema)
+		}
+		for i, column := range resp.Schema {
+			merged.Schema[i].Nullable = merged.Schema[i].Nullable || column.Nullable
+		}
+	}
+	return merged, nil
+}
+
+func sameColumnTypes(a, b []ColumnSchema) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx].Name != b[idx].Name || a[idx].DataType != b[idx].DataType {
+			return false
+		}
+	}
+	return true
+}
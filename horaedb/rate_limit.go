@@ -0,0 +1,221 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// The rate is halved on every flow control error, but never below minRateFactor of the limit.
+	rateDecreaseFactor = 0.5
+	minRateFactor      = 0.05
+	// Every successful write gives back rateIncreaseStep of the limit.
+	rateIncreaseStep = 0.05
+)
+
+// RateLimit limits the points and bytes written per second, zero means no limit. One second of the
+// limit can be written in a burst.
+type RateLimit struct {
+	PointsPerSecond float64
+	BytesPerSecond  float64
+}
+
+func (l RateLimit) enabled() bool {
+	return l.PointsPerSecond > 0 || l.BytesPerSecond > 0
+}
+
+// tokenBucket allows a request larger than the burst by going into debt, the next requests wait for it.
+type tokenBucket struct {
+	limit  float64 // tokens per second without adjustment
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes n tokens at factor of the limit and returns how long the caller has to wait for them.
+func (b *tokenBucket) reserve(n float64, factor float64, now time.Time) time.Duration {
+	if b.limit <= 0 {
+		return 0
+	}
+
+	rate := b.limit * factor
+	if b.last.IsZero() {
+		b.tokens = rate
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+	}
+	if b.tokens > rate {
+		b.tokens = rate
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / rate * float64(time.Second))
+}
+
+// adaptiveLimiter limits points and bytes together, and adjusts the rate by AIMD on flow control errors.
+type adaptiveLimiter struct {
+	mutex  sync.Mutex
+	points tokenBucket
+	bytes  tokenBucket
+	factor float64 // fraction of the limit currently allowed, in range [minRateFactor, 1]
+}
+
+func newAdaptiveLimiter(limit RateLimit) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		points: tokenBucket{limit: limit.PointsPerSecond},
+		bytes:  tokenBucket{limit: limit.BytesPerSecond},
+		factor: 1,
+	}
+}
+
+func (l *adaptiveLimiter) reserve(points, bytes int, now time.Time) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	wait := l.points.reserve(float64(points), l.factor, now)
+	if bytesWait := l.bytes.reserve(float64(bytes), l.factor, now); bytesWait > wait {
+		wait = bytesWait
+	}
+	return wait
+}
+
+func (l *adaptiveLimiter) decrease() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.factor *= rateDecreaseFactor
+	if l.factor < minRateFactor {
+		l.factor = minRateFactor
+	}
+}
+
+func (l *adaptiveLimiter) increase() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.factor += rateIncreaseStep
+	if l.factor > 1 {
+		l.factor = 1
+	}
+}
+
+// writeLimiter applies the global limit to all the points of a write and the table limits to the points of their tables.
+type writeLimiter struct {
+	global *adaptiveLimiter
+	tables map[string]*adaptiveLimiter
+}
+
+// newWriteLimiter returns nil if no limit is set.
+func newWriteLimiter(opts options) *writeLimiter {
+	l := &writeLimiter{
+		tables: make(map[string]*adaptiveLimiter, len(opts.TableRateLimits)),
+	}
+	if opts.RateLimit.enabled() {
+		l.global = newAdaptiveLimiter(opts.RateLimit)
+	}
+	for table, limit := range opts.TableRateLimits {
+		if limit.enabled() {
+			l.tables[table] = newAdaptiveLimiter(limit)
+		}
+	}
+
+	if l.global == nil && len(l.tables) == 0 {
+		return nil
+	}
+	return l
+}
+
+// wait blocks until the points are allowed by all the limits they fall under.
+func (l *writeLimiter) wait(ctx context.Context, points []Point) error {
+	if l == nil {
+		return nil
+	}
+
+	type usage struct {
+		points int
+		bytes  int
+	}
+	total := usage{}
+	tables := make(map[string]*usage)
+	for _, point := range points {
+		size := pointSize(point)
+		total.points++
+		total.bytes += size
+		if _, ok := l.tables[point.Table]; ok {
+			u, ok := tables[point.Table]
+			if !ok {
+				u = &usage{}
+				tables[point.Table] = u
+			}
+			u.points++
+			u.bytes += size
+		}
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	if l.global != nil {
+		wait = l.global.reserve(total.points, total.bytes, now)
+	}
+	for table, u := range tables {
+		if tableWait := l.tables[table].reserve(u.points, u.bytes, now); tableWait > wait {
+			wait = tableWait
+		}
+	}
+
+	if err := sleepWithContext(ctx, wait); err != nil {
+		return errors.Wrap(err, "wait for write rate limit")
+	}
+	return nil
+}
+
+// onResult slows down the limits of the tables after a flow control error, and speeds them up after a success.
+func (l *writeLimiter) onResult(tables []string, err error) {
+	if l == nil {
+		return
+	}
+
+	var adjust func(*adaptiveLimiter)
+	switch {
+	case err == nil:
+		adjust = (*adaptiveLimiter).increase
+	case errors.Is(err, ErrFlowControl):
+		adjust = (*adaptiveLimiter).decrease
+	default:
+		return
+	}
+
+	if l.global != nil {
+		adjust(l.global)
+	}
+	for _, table := range tables {
+		if limiter, ok := l.tables[table]; ok {
+			adjust(limiter)
+		}
+	}
+}
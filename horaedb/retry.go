@@ -0,0 +1,119 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides whether and when a failed Write or SQLQuery is sent again.
+// MaxAttempts counts the first try, so a value of 1 or less disables retrying.
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// Jitter is the fraction of every backoff that is randomized, in range [0, 1].
+	Jitter float64
+
+	RetryOnShouldRetry  bool // code 310
+	RetryOnInvalidRoute bool // ErrInvalidRoute, routes are refreshed before retrying
+	RetryOnFlowControl  bool // ErrFlowControl
+	RetryOnUnavailable  bool // ErrUnavailable, routes are refreshed before retrying
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:         3,
+		InitialBackoff:      100 * time.Millisecond,
+		MaxBackoff:          2 * time.Second,
+		Multiplier:          2,
+		Jitter:              0.2,
+		RetryOnShouldRetry:  true,
+		RetryOnInvalidRoute: true,
+		RetryOnFlowControl:  true,
+		RetryOnUnavailable:  true,
+	}
+}
+
+func noRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+func (p RetryPolicy) canRetry(attempt int, err error) bool {
+	if attempt >= p.MaxAttempts {
+		return false
+	}
+
+	var horaeErr *Error
+	switch {
+	case errors.As(err, &horaeErr) && horaeErr.Code == codeShouldRetry:
+		return p.RetryOnShouldRetry
+	case errors.Is(err, ErrInvalidRoute):
+		return p.RetryOnInvalidRoute
+	case errors.Is(err, ErrFlowControl):
+		return p.RetryOnFlowControl
+	case errors.Is(err, ErrUnavailable):
+		return p.RetryOnUnavailable
+	default:
+		return false
+	}
+}
+
+// backoff returns the wait time before the next attempt, attempt starts from 1.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		backoff *= p.Multiplier
+		if p.MaxBackoff > 0 && backoff >= float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	if p.Jitter > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		backoff -= backoff * jitter * rand.Float64() // nolint:gosec
+	}
+	return time.Duration(backoff)
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -20,9 +20,14 @@
 package horaedb
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/pkg/errors"
 )
 
 type route struct {
@@ -30,18 +35,43 @@ type route struct {
 	Endpoint string
 }
 
+// routeKey identifies a table, tables with the same name in different databases may have different routes.
+type routeKey struct {
+	database string
+	table    string
+}
+
 type routeClient interface {
-	RouteFor(RequestContext, []string) (map[string]route, error)
-	ClearRouteFor([]string)
+	RouteFor(context.Context, RequestContext, []string) (map[string]route, error)
+	ClearRouteFor(RequestContext, []string)
+	// ReportUnavailable is called when a request to the endpoint failed because it is unreachable.
+	ReportUnavailable(endpoint string)
+	Close()
 }
 
-func newRouteClient(endpoint string, routeMode RouteMode, rpcClient *rpcClient, opts options) (routeClient, error) {
+func newRouteClient(endpoints []string, routeMode RouteMode, rpcClient *rpcClient, opts options) (routeClient, error) {
+	if opts.Discoverer != nil {
+		discovered, err := discoverEndpoints(opts)
+		if len(discovered) > 0 {
+			endpoints = discovered
+		} else if len(endpoints) == 0 && err != nil {
+			return nil, errors.Wrap(err, "discover endpoints")
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
 	switch routeMode {
 	case Direct:
 		routeClient := &directRouteClient{
 			opts:      opts,
-			endpoint:  endpoint,
+			seeds:     newEndpointSet(endpoints),
 			rpcClient: rpcClient,
+			inflight:  make(map[flightKey]*routeCall),
+			batches:   make(map[string]*routeBatch),
+			stopCh:    make(chan struct{}),
+			stopped:   make(chan struct{}),
 		}
 		routeCache, err := lru.NewWithEvict(opts.RouteMaxCacheSize, routeClient.OnEvict)
 		if err != nil {
@@ -49,11 +79,18 @@ func newRouteClient(endpoint string, routeMode RouteMode, rpcClient *rpcClient,
 		}
 
 		routeClient.routeCache = routeCache
+		if opts.Discoverer != nil {
+			routeClient.watcher = startEndpointWatcher(routeClient.seeds, opts, rpcClient.forgetEndpoint)
+		}
+		go routeClient.refreshHotRoutes()
 		return routeClient, nil
 	case Proxy:
 		routeClient := &proxyRouteClient{
-			endpoint:  endpoint,
-			rpcClient: rpcClient,
+			opts:    opts,
+			proxies: newEndpointSet(endpoints),
+		}
+		if opts.Discoverer != nil {
+			routeClient.watcher = startEndpointWatcher(routeClient.proxies, opts, rpcClient.forgetEndpoint)
 		}
 		return routeClient, nil
 	default:
@@ -63,95 +100,289 @@ func newRouteClient(endpoint string, routeMode RouteMode, rpcClient *rpcClient,
 
 type directRouteClient struct {
 	opts       options
-	endpoint   string
+	seeds      *endpointSet // endpoints to send Route RPCs to
+	watcher    *endpointWatcher
 	rpcClient  *rpcClient
-	routeCache *lru.Cache // table -> *route
+	mutex      sync.Mutex // serialize updates of routeCache to keep route refs of rpcClient right
+	routeCache *lru.Cache // routeKey -> *routeEntry
+
+	flightMutex sync.Mutex
+	inflight    map[flightKey]*routeCall // misses with a Route RPC in flight
+	batches     map[string]*routeBatch   // database and metadata -> misses waiting for the batch window
+
+	stopCh  chan struct{}
+	stopped chan struct{}
 }
 
-func (c *directRouteClient) RouteFor(reqCtx RequestContext, tables []string) (map[string]route, error) {
+type routeEntry struct {
+	route    route
+	metadata map[string]string // metadata of the request which fetched the route, reused to refresh it
+	expireAt time.Time         // zero if routes never expire
+	lastHit  int64             // unix nano of the last cache hit
+}
+
+func (e *routeEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+func (c *directRouteClient) RouteFor(ctx context.Context, reqCtx RequestContext, tables []string) (map[string]route, error) {
 	if len(tables) == 0 {
 		return nil, ErrNullRouteTables
 	}
 
 	local := make(map[string]route, len(tables))
 	misses := make([]string, 0, len(tables))
+	stale := make(map[string]route)
 
+	now := time.Now()
 	for _, table := range tables {
-		if v, ok := c.routeCache.Get(table); ok {
-			local[table] = v.(route)
-		} else {
-			misses = append(misses, table)
+		if v, ok := c.routeCache.Get(routeKey{database: reqCtx.Database, table: table}); ok {
+			entry := v.(*routeEntry)
+			atomic.StoreInt64(&entry.lastHit, now.UnixNano())
+			if !entry.expired(now) {
+				local[table] = entry.route
+				continue
+			}
+			stale[table] = entry.route
 		}
+		misses = append(misses, table)
 	}
 
 	if len(misses) == 0 {
 		return local, nil
 	}
 
-	if err := c.routeFreshFor(reqCtx, misses); err != nil {
-		return nil, err
+	if err := c.routeFreshFor(ctx, reqCtx, misses); err != nil {
+		// Expired routes are only served when they can't be refreshed.
+		if len(stale) < len(misses) {
+			return nil, err
+		}
+		if c.opts.LoggerDebug {
+			_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Use expired tables route for refresh failure, tables:%v, err:%v\n", misses, err)))
+		}
+		for table, r := range stale {
+			local[table] = r
+		}
+		return local, nil
 	}
 
+	// All the unrouted tables of a request go to the same seed, so they are not split across endpoints.
+	var seed string
 	for _, table := range misses {
-		if v, ok := c.routeCache.Get(table); ok {
-			local[table] = v.(route)
-		} else {
-			local[table] = route{
-				Table:    table,
-				Endpoint: c.endpoint,
-			}
+		if v, ok := c.routeCache.Get(routeKey{database: reqCtx.Database, table: table}); ok {
+			local[table] = v.(*routeEntry).route
+			continue
+		}
+		if seed == "" {
+			seed = c.seeds.pick()
+		}
+		local[table] = route{
+			Table:    table,
+			Endpoint: seed,
 		}
 	}
 	return local, nil
 }
 
-func (c *directRouteClient) routeFreshFor(reqCtx RequestContext, tables []string) error {
-	routes, err := c.rpcClient.Route(c.endpoint, reqCtx, tables)
-	if err != nil {
-		return err
+// fetchRoutes sends one Route RPC for the tables and caches the returned routes.
+// The seeds are tried in turn until one of them is reachable.
+func (c *directRouteClient) fetchRoutes(ctx context.Context, reqCtx RequestContext, tables []string) error {
+	var lastErr error
+	for _, endpoint := range c.seeds.ordered() {
+		routes, err := c.rpcClient.Route(ctx, endpoint, reqCtx, tables)
+		if err == nil {
+			c.seeds.markSuccess(endpoint)
+			c.cacheRoutes(reqCtx, routes)
+			return nil
+		}
+
+		lastErr = err
+		if !isEndpointUnavailable(err) || ctx.Err() != nil {
+			return err
+		}
+		c.seeds.markFailure(endpoint)
+		if c.opts.LoggerDebug {
+			_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Route by seed failed, try next one, endpoint:%s, err:%v\n", endpoint, err)))
+		}
+	}
+	if lastErr == nil {
+		return ErrNoEndpoints
+	}
+	return lastErr
+}
+
+func (c *directRouteClient) cacheRoutes(reqCtx RequestContext, routes map[string]route) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Copied since the caller may reuse the map of its request.
+	var metadata map[string]string
+	if len(reqCtx.Metadata) > 0 {
+		metadata = make(map[string]string, len(reqCtx.Metadata))
+		for k, v := range reqCtx.Metadata {
+			metadata[k] = v
+		}
 	}
 
-	for _, route := range routes {
-		c.routeCache.Add(route.Table, route)
+	now := time.Now()
+	for _, r := range routes {
+		key := routeKey{database: reqCtx.Database, table: r.Table}
+		entry := &routeEntry{
+			route:    r,
+			metadata: metadata,
+		}
+		if c.opts.RouteTTL > 0 {
+			entry.expireAt = now.Add(c.opts.RouteTTL)
+		}
+
+		if v, ok := c.routeCache.Peek(key); ok {
+			// Replacing a cached route doesn't trigger the evict callback.
+			old := v.(*routeEntry)
+			entry.lastHit = atomic.LoadInt64(&old.lastHit)
+			if oldEndpoint := old.route.Endpoint; oldEndpoint != r.Endpoint {
+				c.rpcClient.removeRoute(oldEndpoint)
+				c.rpcClient.addRoute(r.Endpoint)
+			}
+		} else {
+			c.rpcClient.addRoute(r.Endpoint)
+		}
+		c.routeCache.Add(key, entry)
 	}
-	return nil
 }
 
-func (c *directRouteClient) ClearRouteFor(tables []string) {
+// hotRouteGroup is the hot tables refreshed by one request.
+type hotRouteGroup struct {
+	reqCtx RequestContext
+	tables []string
+}
+
+// refreshHotRoutes renews the routes which were hit during the last TTL and will expire soon,
+// so that busy tables never see an expired route.
+func (c *directRouteClient) refreshHotRoutes() {
+	defer close(c.stopped)
+
+	ttl := c.opts.RouteTTL
+	if ttl <= 0 {
+		<-c.stopCh
+		return
+	}
+
+	ticker := time.NewTicker(ttl / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			hotSince := now.Add(-ttl).UnixNano()
+			refreshBefore := now.Add(ttl / 5)
+
+			hotRoutes := make(map[string]*hotRouteGroup) // database and metadata -> tables
+			for _, key := range c.routeCache.Keys() {
+				v, ok := c.routeCache.Peek(key)
+				if !ok {
+					continue
+				}
+				entry := v.(*routeEntry)
+				if atomic.LoadInt64(&entry.lastHit) < hotSince || entry.expireAt.After(refreshBefore) {
+					continue
+				}
+				reqCtx := RequestContext{Database: key.(routeKey).database, Metadata: entry.metadata}
+				group := reqCtx.Database + "\x00" + metadataKey(reqCtx.Metadata)
+				if _, ok := hotRoutes[group]; !ok {
+					hotRoutes[group] = &hotRouteGroup{reqCtx: reqCtx}
+				}
+				hotRoutes[group].tables = append(hotRoutes[group].tables, entry.route.Table)
+			}
+
+			for _, hot := range hotRoutes {
+				ctx, cancel := context.WithTimeout(context.Background(), ttl/5)
+				err := c.routeFreshFor(ctx, hot.reqCtx, hot.tables)
+				cancel()
+				if err != nil && c.opts.LoggerDebug {
+					_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Refresh hot tables route failed, tables:%v, err:%v\n", hot.tables, err)))
+				}
+			}
+		case <-c.stopCh:
+			return
+		}
+	}
+}
+
+// cachedEndpoint returns the cached endpoint of the table without any RPC, empty if it is not cached.
+func (c *directRouteClient) cachedEndpoint(database, table string) string {
+	if v, ok := c.routeCache.Peek(routeKey{database: database, table: table}); ok {
+		return v.(*routeEntry).route.Endpoint
+	}
+	return ""
+}
+
+func (c *directRouteClient) ClearRouteFor(reqCtx RequestContext, tables []string) {
 	if c.opts.LoggerDebug {
-		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Clear tables route for refresh code, tables:%v\n", tables)))
+		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Clear tables route for refresh code, database:%s, tables:%v\n", reqCtx.Database, tables)))
 	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	for _, table := range tables {
-		c.routeCache.Remove(table)
+		c.routeCache.Remove(routeKey{database: reqCtx.Database, table: table})
+	}
+}
+
+func (c *directRouteClient) ReportUnavailable(endpoint string) {
+	// Data nodes are also used as seeds sometimes.
+	if c.seeds.contains(endpoint) {
+		c.seeds.markFailure(endpoint)
 	}
 }
 
-func (c *directRouteClient) OnEvict(table, _ interface{}) {
+// OnEvict is called by the Add and Remove of routeCache, the callers hold c.mutex.
+func (c *directRouteClient) OnEvict(key, value interface{}) {
 	if c.opts.LoggerDebug {
-		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Clear table route for evict, table:%s\n", table)))
+		k := key.(routeKey)
+		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Clear table route for evict, database:%s, table:%s\n", k.database, k.table)))
 	}
+	c.rpcClient.removeRoute(value.(*routeEntry).route.Endpoint)
+}
+
+func (c *directRouteClient) Close() {
+	c.watcher.stop()
+	close(c.stopCh)
+	<-c.stopped
 }
 
 type proxyRouteClient struct {
-	endpoint  string
-	rpcClient *rpcClient
+	opts    options
+	proxies *endpointSet
+	watcher *endpointWatcher
 }
 
-func (c *proxyRouteClient) RouteFor(_ RequestContext, tables []string) (map[string]route, error) {
+// RouteFor sends all the tables of a request to one proxy, the proxies take turns between requests.
+func (c *proxyRouteClient) RouteFor(_ context.Context, _ RequestContext, tables []string) (map[string]route, error) {
 	if len(tables) == 0 {
 		return nil, ErrNullRouteTables
 	}
 
+	endpoint := c.proxies.pick()
 	routes := make(map[string]route, len(tables))
 	for _, table := range tables {
 		routes[table] = route{
 			Table:    table,
-			Endpoint: c.endpoint,
+			Endpoint: endpoint,
 		}
 	}
 	return routes, nil
 }
 
-func (c *proxyRouteClient) ClearRouteFor([]string) {
+func (c *proxyRouteClient) ClearRouteFor(RequestContext, []string) {
 	// do noting
 }
+
+func (c *proxyRouteClient) ReportUnavailable(endpoint string) {
+	if c.opts.LoggerDebug {
+		_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Proxy is unavailable, endpoint:%s\n", endpoint)))
+	}
+	c.proxies.markFailure(endpoint)
+}
+
+func (c *proxyRouteClient) Close() {
+	c.watcher.stop()
+}
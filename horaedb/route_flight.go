@@ -0,0 +1,188 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+)
+
+// flightKey identifies a shared Route RPC, misses with different metadata are never shared, the metadata
+// may carry the tenant or the credentials of the request.
+type flightKey struct {
+	routeKey
+	metadata string
+}
+
+// routeCall is a Route RPC shared by all the concurrent misses of its tables.
+type routeCall struct {
+	batch *routeBatch
+	done  chan struct{}
+	err   error
+}
+
+// routeBatch collects the misses of one database and metadata during the batch window. Its RPC is
+// canceled once no caller waits for it any more.
+type routeBatch struct {
+	reqCtx  RequestContext
+	tables  []string
+	calls   []*routeCall
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiters int // protected by directRouteClient.flightMutex
+}
+
+func newRouteBatch(reqCtx RequestContext) *routeBatch {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &routeBatch{reqCtx: reqCtx, ctx: ctx, cancel: cancel}
+}
+
+// metadataKey encodes the metadata in a stable order.
+func metadataKey(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(metadata[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+// routeFreshFor fetches the routes of the tables and caches them. Concurrent misses of the same
+// (database, table, metadata) share one Route RPC, and misses within RouteBatchWindow are sent in one
+// request. The shared RPC is canceled when all the callers waiting for it are gone.
+func (c *directRouteClient) routeFreshFor(ctx context.Context, reqCtx RequestContext, tables []string) error {
+	md := metadataKey(reqCtx.Metadata)
+	waits := make([]*routeCall, 0, len(tables))
+	owned := make([]string, 0, len(tables))
+	ownedCalls := make([]*routeCall, 0, len(tables))
+
+	c.flightMutex.Lock()
+	for _, table := range tables {
+		key := flightKey{routeKey: routeKey{database: reqCtx.Database, table: table}, metadata: md}
+		if call, ok := c.inflight[key]; ok && call.batch.ctx.Err() == nil {
+			call.batch.waiters++
+			waits = append(waits, call)
+			continue
+		}
+
+		call := &routeCall{done: make(chan struct{})}
+		c.inflight[key] = call
+		waits = append(waits, call)
+		owned = append(owned, table)
+		ownedCalls = append(ownedCalls, call)
+	}
+	if len(owned) > 0 {
+		c.scheduleLocked(reqCtx, md, owned, ownedCalls)
+	}
+	c.flightMutex.Unlock()
+
+	defer func() {
+		c.flightMutex.Lock()
+		defer c.flightMutex.Unlock()
+
+		for _, call := range waits {
+			call.batch.waiters--
+			if call.batch.waiters == 0 {
+				call.batch.cancel()
+			}
+		}
+	}()
+
+	for _, call := range waits {
+		select {
+		case <-call.done:
+			if call.err != nil {
+				return call.err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (c *directRouteClient) scheduleLocked(reqCtx RequestContext, md string, tables []string, calls []*routeCall) {
+	var batch *routeBatch
+	if c.opts.RouteBatchWindow <= 0 {
+		batch = newRouteBatch(reqCtx)
+	} else {
+		key := reqCtx.Database + "\x00" + md
+		existing, ok := c.batches[key]
+		if ok && existing.ctx.Err() == nil {
+			batch = existing
+		} else {
+			batch = newRouteBatch(reqCtx)
+			c.batches[key] = batch
+			time.AfterFunc(c.opts.RouteBatchWindow, func() {
+				c.flightMutex.Lock()
+				if c.batches[key] == batch {
+					delete(c.batches, key)
+				}
+				c.flightMutex.Unlock()
+
+				c.sendBatch(batch)
+			})
+		}
+	}
+
+	for _, call := range calls {
+		call.batch = batch
+	}
+	batch.tables = append(batch.tables, tables...)
+	batch.calls = append(batch.calls, calls...)
+	batch.waiters += len(calls)
+
+	if c.opts.RouteBatchWindow <= 0 {
+		// Send only after the batch is filled, sendBatch reads it without the lock.
+		go c.sendBatch(batch)
+	}
+}
+
+func (c *directRouteClient) sendBatch(batch *routeBatch) {
+	err := batch.ctx.Err()
+	if err == nil {
+		err = c.fetchRoutes(batch.ctx, batch.reqCtx, batch.tables)
+	}
+
+	c.flightMutex.Lock()
+	defer c.flightMutex.Unlock()
+
+	batch.cancel()
+	md := metadataKey(batch.reqCtx.Metadata)
+	for idx, table := range batch.tables {
+		key := flightKey{routeKey: routeKey{database: batch.reqCtx.Database, table: table}, metadata: md}
+		call := batch.calls[idx]
+		if c.inflight[key] == call {
+			delete(c.inflight, key)
+		}
+		call.err = err
+		close(call.done)
+	}
+}
@@ -0,0 +1,237 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// RowIterator reads the result of QueryStream, only one Arrow record is decoded in memory at a time.
+//
+//	it, err := client.(horaedb.QueryStreamClient).QueryStream(ctx, req)
+//	defer it.Close()
+//	for it.Next() {
+//		row := it.Row()
+//	}
+//	err = it.Err()
+type RowIterator struct {
+	stream  storagepb.StorageService_StreamSqlQueryClient
+	cancel  context.CancelFunc
+	release func()
+
+	payload       *storagepb.ArrowPayload // response being read
+	batchIdx      int                     // next batch in payload
+	reader        *ipc.Reader             // reader of the current batch
+	schema        *rowSchema              // schema of the last record
+	timestampType bool
+	rows          []Row // rows of the current record
+	rowIdx        int
+	row           Row
+	affectedRows  uint32
+	err           error
+	done          bool
+}
+
+// QueryStream starts a streaming query, the iterator counts as an inflight request of the client until it is closed.
+func (c *clientImpl) QueryStream(ctx context.Context, req SQLQueryRequest) (*RowIterator, error) {
+	if err := c.withDefaultRequestContext(&req.ReqCtx); err != nil {
+		return nil, pkgerrors.Wrap(err, "add request ctx")
+	}
+
+	if len(req.Tables) == 0 {
+		req.Tables = ExtractTables(req.SQL)
+	}
+	if len(req.Tables) == 0 {
+		return nil, ErrNullRequestTables
+	}
+
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+
+	it, err := c.queryStream(ctx, req)
+	if err != nil {
+		c.release()
+		return nil, err
+	}
+	return it, nil
+}
+
+func (c *clientImpl) queryStream(ctx context.Context, req SQLQueryRequest) (*RowIterator, error) {
+	groups, err := c.routeTableGroups(ctx, req.ReqCtx, req.Tables)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := groups[0].endpoint
+	if len(groups) > 1 {
+		// The results of sub-queries can't be merged while streaming, only a proxy can serve the query.
+		if c.proxies == nil {
+			return nil, newRouteConflictError(groups)
+		}
+		endpoint = c.proxies.pick()
+	}
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	stream, err := c.rpcClient.StreamSQLQuery(streamCtx, endpoint, req)
+	if len(groups) > 1 {
+		c.markProxyResult(endpoint, err)
+	} else if err != nil {
+		c.clearRouteOnError(req.ReqCtx, endpoint, req.Tables, err)
+	}
+	if err != nil {
+		cancel()
+		return nil, pkgerrors.Wrap(err, "do grpc stream query")
+	}
+
+	return &RowIterator{
+		stream:        stream,
+		cancel:        cancel,
+		release:       c.release,
+		timestampType: c.rpcClient.opts.TimestampDataType,
+	}, nil
+}
+
+// Next advances to the next row, it returns false when the result is exhausted or an error occurs.
+func (it *RowIterator) Next() bool {
+	for !it.done {
+		if it.rowIdx < len(it.rows) {
+			it.row = it.rows[it.rowIdx]
+			it.rowIdx++
+			return true
+		}
+
+		if err := it.nextRecord(); err != nil {
+			if !errors.Is(err, io.EOF) {
+				it.err = err
+			}
+			it.finish()
+		}
+	}
+	return false
+}
+
+// Row returns the current row, it is valid after Next returns true.
+func (it *RowIterator) Row() Row {
+	return it.row
+}
+
+// AffectedRows returns the affected rows reported by the server so far.
+func (it *RowIterator) AffectedRows() uint32 {
+	return it.affectedRows
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *RowIterator) Err() error {
+	return it.err
+}
+
+// Close stops the stream, it is safe to call Close more than once.
+func (it *RowIterator) Close() error {
+	it.finish()
+	return nil
+}
+
+func (it *RowIterator) finish() {
+	if it.done {
+		return
+	}
+	it.done = true
+	it.rows = nil
+	if it.reader != nil {
+		it.reader.Release()
+		it.reader = nil
+	}
+	it.cancel()
+	it.release()
+}
+
+// nextRecord decodes the next Arrow record into it.rows, it returns io.EOF at the end of the stream.
+func (it *RowIterator) nextRecord() error {
+	for {
+		if it.reader != nil {
+			if it.reader.Next() {
+				it.schema = rowSchemaOf(it.schema, it.reader.Schema(), it.timestampType)
+				it.rows = convertArrowRecordToRow(it.schema, it.reader.Record())
+				it.rowIdx = 0
+				return nil
+			}
+			err := it.reader.Err()
+			it.reader.Release()
+			it.reader = nil
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+		}
+
+		if it.payload != nil && it.batchIdx < len(it.payload.RecordBatches) {
+			reader, err := newArrowBatchReader(it.payload.RecordBatches[it.batchIdx], it.payload.Compression)
+			if err != nil {
+				return err
+			}
+			it.batchIdx++
+			it.reader = reader
+			continue
+		}
+
+		if err := it.recvPayload(); err != nil {
+			return err
+		}
+	}
+}
+
+func (it *RowIterator) recvPayload() error {
+	it.payload = nil
+	it.batchIdx = 0
+
+	queryResponse, err := it.stream.Recv()
+	if err != nil {
+		return convertGRPCError(err)
+	}
+
+	if queryResponse.Header == nil {
+		return &Error{
+			Code: codeInternal,
+			Err:  ErrResponseHeaderMiss.Error(),
+		}
+	}
+
+	if queryResponse.Header.Code != codeSuccess {
+		return &Error{
+			Code: queryResponse.Header.Code,
+			Err:  queryResponse.Header.Error,
+		}
+	}
+
+	switch output := queryResponse.Output.(type) {
+	case *storagepb.SqlQueryResponse_AffectedRows:
+		it.affectedRows += output.AffectedRows
+	case *storagepb.SqlQueryResponse_Arrow:
+		it.payload = output.Arrow
+	default:
+		return ErrOnlyArrowSupport
+	}
+	return nil
+}
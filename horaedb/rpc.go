@@ -22,10 +22,13 @@ package horaedb
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/apache/arrow/go/arrow"
 	"github.com/apache/arrow/go/arrow/array"
@@ -33,27 +36,58 @@ import (
 	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
 	"github.com/klauspost/compress/zstd"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials"
 )
 
 type rpcClient struct {
 	opts     options
-	mutex    sync.Mutex // protect grpc conn init
-	connPool sync.Map   // endpoint -> *grpc.ClientConn
+	creds    credentials.TransportCredentials
+	mutex    sync.Mutex // protect grpc conn init, use and close
+	connPool sync.Map   // endpoint -> *grpcConnEntry
+	closed   bool
+	breakers sync.Map // endpoint -> *circuitBreaker
+
+	routesMutex sync.Mutex
+	routeRefs   map[string]int // endpoint -> number of cached routes to it
+
+	stopCh  chan struct{}
+	stopped chan struct{}
+}
+
+// grpcConnEntry is protected by rpcClient.mutex.
+type grpcConnEntry struct {
+	conn       *grpc.ClientConn
+	active     int       // RPCs and streams running on the conn
+	lastActive time.Time // updated when the conn becomes idle and when the endpoint loses its last route
 }
 
-func newRPCClient(opts options) *rpcClient {
-	return &rpcClient{
-		opts:     opts,
-		connPool: sync.Map{},
+func newRPCClient(opts options) (*rpcClient, error) {
+	creds, err := newTransportCredentials(opts.TLS)
+	if err != nil {
+		return nil, err
 	}
+
+	c := &rpcClient{
+		opts:      opts,
+		creds:     creds,
+		connPool:  sync.Map{},
+		routeRefs: make(map[string]int),
+		stopCh:    make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go c.evictIdleConns()
+	return c, nil
 }
 
 func (c *rpcClient) SQLQuery(ctx context.Context, endpoint string, req SQLQueryRequest) (SQLQueryResponse, error) {
-	grpcConn, err := c.getGrpcConn(endpoint)
+	if err := c.checkBreaker(endpoint); err != nil {
+		return SQLQueryResponse{}, err
+	}
+	grpcConn, release, err := c.getGrpcConn(endpoint)
 	if err != nil {
 		return SQLQueryResponse{}, err
 	}
+	defer release()
 
 	grpcClient := storagepb.NewStorageServiceClient(grpcConn)
 	queryRequest := &storagepb.SqlQueryRequest{
@@ -63,7 +97,11 @@ func (c *rpcClient) SQLQuery(ctx context.Context, endpoint string, req SQLQueryR
 		Tables: req.Tables,
 		Sql:    req.SQL,
 	}
-	queryResponse, err := grpcClient.SqlQuery(ctx, queryRequest)
+	rpcCtx, cancel := withDefaultTimeout(ctx, c.opts.QueryTimeout)
+	defer cancel()
+	queryResponse, err := grpcClient.SqlQuery(withOutgoingMetadata(rpcCtx, c.opts.Metadata, req.ReqCtx), queryRequest)
+	err = convertGRPCError(err)
+	c.recordResult(ctx, endpoint, err)
 	if err != nil {
 		return SQLQueryResponse{}, err
 	}
@@ -89,7 +127,7 @@ func (c *rpcClient) SQLQuery(ctx context.Context, endpoint string, req SQLQueryR
 		}, nil
 	}
 
-	rows, err := parseQueryResponse(queryResponse)
+	rows, schema, err := parseQueryResponse(queryResponse, c.opts.TimestampDataType)
 	if err != nil {
 		return SQLQueryResponse{}, err
 	}
@@ -98,14 +136,47 @@ func (c *rpcClient) SQLQuery(ctx context.Context, endpoint string, req SQLQueryR
 		SQL:          req.SQL,
 		AffectedRows: queryResponse.GetAffectedRows(),
 		Rows:         rows,
+		Schema:       schema,
 	}, nil
 }
 
+// StreamSQLQuery starts a server-streaming query, every response carries a part of the result.
+func (c *rpcClient) StreamSQLQuery(ctx context.Context, endpoint string, req SQLQueryRequest) (storagepb.StorageService_StreamSqlQueryClient, error) {
+	if err := c.checkBreaker(endpoint); err != nil {
+		return nil, err
+	}
+	grpcConn, release, err := c.getGrpcConn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcClient := storagepb.NewStorageServiceClient(grpcConn)
+	queryRequest := &storagepb.SqlQueryRequest{
+		Context: &storagepb.RequestContext{
+			Database: req.ReqCtx.Database,
+		},
+		Tables: req.Tables,
+		Sql:    req.SQL,
+	}
+	stream, err := grpcClient.StreamSqlQuery(withOutgoingMetadata(ctx, c.opts.Metadata, req.ReqCtx), queryRequest)
+	err = convertGRPCError(err)
+	c.recordResult(ctx, endpoint, err)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &trackedQueryStream{StorageService_StreamSqlQueryClient: stream, end: trackStream(ctx, release)}, nil
+}
+
 func (c *rpcClient) Write(ctx context.Context, endpoint string, reqCtx RequestContext, points []Point) (WriteResponse, error) {
-	grpcConn, err := c.getGrpcConn(endpoint)
+	if err := c.checkBreaker(endpoint); err != nil {
+		return WriteResponse{}, err
+	}
+	grpcConn, release, err := c.getGrpcConn(endpoint)
 	if err != nil {
 		return WriteResponse{}, err
 	}
+	defer release()
 
 	grpcClient := storagepb.NewStorageServiceClient(grpcConn)
 	writeRequest, err := buildPbWriteRequest(points)
@@ -116,11 +187,50 @@ func (c *rpcClient) Write(ctx context.Context, endpoint string, reqCtx RequestCo
 	writeRequest.Context = &storagepb.RequestContext{
 		Database: reqCtx.Database,
 	}
-	writeResponse, err := grpcClient.Write(ctx, writeRequest)
+	rpcCtx, cancel := withDefaultTimeout(ctx, c.opts.WriteTimeout)
+	defer cancel()
+	writeResponse, err := grpcClient.Write(withOutgoingMetadata(rpcCtx, c.opts.Metadata, reqCtx), writeRequest)
+	err = convertGRPCError(err)
+	c.recordResult(ctx, endpoint, err)
 	if err != nil {
 		return WriteResponse{}, err
 	}
 
+	return convertWriteResponse(writeResponse)
+}
+
+// StreamWrite opens a client-side write stream to the endpoint, the stream lives until ctx is done.
+func (c *rpcClient) StreamWrite(ctx context.Context, endpoint string, reqCtx RequestContext) (storagepb.StorageService_StreamWriteClient, error) {
+	if err := c.checkBreaker(endpoint); err != nil {
+		return nil, err
+	}
+	grpcConn, release, err := c.getGrpcConn(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	grpcClient := storagepb.NewStorageServiceClient(grpcConn)
+	stream, err := grpcClient.StreamWrite(withOutgoingMetadata(ctx, c.opts.Metadata, reqCtx))
+	err = convertGRPCError(err)
+	c.recordResult(ctx, endpoint, err)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &trackedWriteStream{StorageService_StreamWriteClient: stream, end: trackStream(ctx, release)}, nil
+}
+
+// CloseStreamWrite closes the sending side of the stream and waits for the aggregated response.
+func (c *rpcClient) CloseStreamWrite(stream storagepb.StorageService_StreamWriteClient) (WriteResponse, error) {
+	writeResponse, err := stream.CloseAndRecv()
+	if err != nil {
+		return WriteResponse{}, convertGRPCError(err)
+	}
+
+	return convertWriteResponse(writeResponse)
+}
+
+func convertWriteResponse(writeResponse *storagepb.WriteResponse) (WriteResponse, error) {
 	if writeResponse.Header == nil {
 		return WriteResponse{}, &Error{
 			Code: codeInternal,
@@ -141,11 +251,15 @@ func (c *rpcClient) Write(ctx context.Context, endpoint string, reqCtx RequestCo
 	}, nil
 }
 
-func (c *rpcClient) Route(endpoint string, reqCtx RequestContext, tables []string) (map[string]route, error) {
-	grpcConn, err := c.getGrpcConn(endpoint)
+func (c *rpcClient) Route(ctx context.Context, endpoint string, reqCtx RequestContext, tables []string) (map[string]route, error) {
+	if err := c.checkBreaker(endpoint); err != nil {
+		return nil, err
+	}
+	grpcConn, release, err := c.getGrpcConn(endpoint)
 	if err != nil {
 		return nil, err
 	}
+	defer release()
 	grpcClient := storagepb.NewStorageServiceClient(grpcConn)
 
 	routeRequest := &storagepb.RouteRequest{
@@ -154,7 +268,11 @@ func (c *rpcClient) Route(endpoint string, reqCtx RequestContext, tables []strin
 		},
 		Tables: tables,
 	}
-	routeResponse, err := grpcClient.Route(context.Background(), routeRequest)
+	rpcCtx, cancel := withDefaultTimeout(ctx, c.opts.RouteTimeout)
+	defer cancel()
+	routeResponse, err := grpcClient.Route(withOutgoingMetadata(rpcCtx, c.opts.Metadata, reqCtx), routeRequest)
+	err = convertGRPCError(err)
+	c.recordResult(ctx, endpoint, err)
 	if err != nil {
 		return nil, err
 	}
@@ -187,31 +305,210 @@ func (c *rpcClient) Route(endpoint string, reqCtx RequestContext, tables []strin
 	return routes, nil
 }
 
-func (c *rpcClient) getGrpcConn(endpoint string) (*grpc.ClientConn, error) {
-	if conn, ok := c.connPool.Load(endpoint); ok {
-		return conn.(*grpc.ClientConn), nil
+// withDefaultTimeout applies the timeout only when ctx has no deadline, zero timeout means no limit.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return ctx, func() {}
 	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// getGrpcConn returns the conn of the endpoint, it is not evicted until release is called.
+func (c *rpcClient) getGrpcConn(endpoint string) (*grpc.ClientConn, func(), error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	return c.newGrpcConn(endpoint)
+	if c.closed {
+		return nil, nil, ErrClientClosed
+	}
+
+	entry, ok := c.connPool.Load(endpoint)
+	if !ok {
+		conn, err := c.newGrpcConn(endpoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		entry = &grpcConnEntry{conn: conn}
+		c.connPool.Store(endpoint, entry)
+	}
+
+	connEntry := entry.(*grpcConnEntry)
+	connEntry.active++
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+
+			connEntry.active--
+			connEntry.lastActive = time.Now()
+		})
+	}
+	return connEntry.conn, release, nil
 }
 
 func (c *rpcClient) newGrpcConn(endpoint string) (*grpc.ClientConn, error) {
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(c.creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(c.opts.RPCMaxRecvMsgSize)),
+	}
+	if c.opts.PerRPCCredentials != nil {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(c.opts.PerRPCCredentials))
+	}
+	return grpc.Dial(endpoint, dialOpts...)
+}
+
+// trackStream returns the func that ends the stream, it is called by the stream itself or when ctx is done.
+func trackStream(ctx context.Context, release func()) func() {
+	var once sync.Once
+	done := make(chan struct{})
+	end := func() {
+		once.Do(func() {
+			close(done)
+			release()
+		})
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			end()
+		case <-done:
+		}
+	}()
+	return end
+}
+
+// trackedQueryStream releases its conn once the stream is drained or fails.
+type trackedQueryStream struct {
+	storagepb.StorageService_StreamSqlQueryClient
+	end func()
+}
+
+func (s *trackedQueryStream) Recv() (*storagepb.SqlQueryResponse, error) {
+	resp, err := s.StorageService_StreamSqlQueryClient.Recv()
+	if err != nil {
+		s.end()
+	}
+	return resp, err
+}
+
+// trackedWriteStream releases its conn once the stream is closed.
+type trackedWriteStream struct {
+	storagepb.StorageService_StreamWriteClient
+	end func()
+}
+
+func (s *trackedWriteStream) CloseAndRecv() (*storagepb.WriteResponse, error) {
+	defer s.end()
+	return s.StorageService_StreamWriteClient.CloseAndRecv()
+}
+
+// addRoute records that a cached route points to the endpoint, its conn is never evicted while routed.
+func (c *rpcClient) addRoute(endpoint string) {
+	c.routesMutex.Lock()
+	defer c.routesMutex.Unlock()
+
+	c.routeRefs[endpoint]++
+}
+
+// removeRoute is called when a cached route to the endpoint is cleared or evicted.
+func (c *rpcClient) removeRoute(endpoint string) {
+	c.routesMutex.Lock()
+	c.routeRefs[endpoint]--
+	lastRoute := c.routeRefs[endpoint] <= 0
+	if lastRoute {
+		delete(c.routeRefs, endpoint)
+	}
+	c.routesMutex.Unlock()
+	if !lastRoute {
+		return
+	}
+
+	// The idle time of an endpoint starts when it loses its last route.
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if entry, ok := c.connPool.Load(endpoint); ok {
+		entry.(*grpcConnEntry).lastActive = time.Now()
+	}
+}
+
+func (c *rpcClient) isRouted(endpoint string) bool {
+	c.routesMutex.Lock()
+	defer c.routesMutex.Unlock()
 
-	if conn, ok := c.connPool.Load(endpoint); ok {
-		return conn.(*grpc.ClientConn), nil
+	return c.routeRefs[endpoint] > 0
+}
+
+// evictIdleConns closes the conns whose endpoint has no route and no running RPC or stream for
+// ConnIdleTimeout.
+func (c *rpcClient) evictIdleConns() {
+	defer close(c.stopped)
+
+	if c.opts.ConnIdleTimeout <= 0 {
+		<-c.stopCh
+		return
 	}
 
-	conn, err := grpc.Dial(endpoint,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(c.opts.RPCMaxRecvMsgSize)))
-	if err != nil {
-		return nil, err
+	ticker := time.NewTicker(c.opts.ConnIdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.evictIdleConnsOnce(time.Now().Add(-c.opts.ConnIdleTimeout))
+		case <-c.stopCh:
+			return
+		}
 	}
+}
+
+func (c *rpcClient) evictIdleConnsOnce(deadline time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 
-	c.connPool.Store(endpoint, conn)
-	return conn, nil
+	c.connPool.Range(func(endpoint, entry interface{}) bool {
+		connEntry := entry.(*grpcConnEntry)
+		if connEntry.active > 0 || connEntry.lastActive.After(deadline) || c.isRouted(endpoint.(string)) {
+			return true
+		}
+
+		if c.opts.LoggerDebug {
+			_, _ = c.opts.Logger.Write([]byte(fmt.Sprintf("Close idle grpc conn, endpoint:%s\n", endpoint)))
+		}
+		c.connPool.Delete(endpoint)
+		c.breakers.Delete(endpoint)
+		_ = connEntry.conn.Close()
+		return true
+	})
+}
+
+// Close closes all pooled conns, the RPCs still running on them are canceled.
+func (c *rpcClient) Close() error {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mutex.Unlock()
+
+	close(c.stopCh)
+	<-c.stopped
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var firstErr error
+	c.connPool.Range(func(endpoint, entry interface{}) bool {
+		c.connPool.Delete(endpoint)
+		if err := entry.(*grpcConnEntry).conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return true
+	})
+	return firstErr
 }
 
 func buildPbWriteRequest(points []Point) (*storagepb.WriteRequest, error) {
@@ -228,13 +525,10 @@ func buildPbWriteRequest(points []Point) (*storagepb.WriteRequest, error) {
 			tuples[point.Table] = tuple
 		}
 
-		seriesKey := ""
 		for tagK := range point.Tags {
 			tuple.orderedTags.insert(tagK)
 		}
-		for _, orderedTag := range tuple.orderedTags.toOrdered() {
-			seriesKey += point.Tags[orderedTag].StringValue()
-		}
+		seriesKey := buildSeriesKey(point.Tags)
 
 		writeEntry, ok := tuple.writeSeriesEntries[seriesKey]
 		if !ok {
@@ -298,6 +592,32 @@ func buildPbWriteRequest(points []Point) (*storagepb.WriteRequest, error) {
 	return writeRequest, nil
 }
 
+// buildSeriesKey encodes the non-null tags sorted by name, every name and value is prefixed by its length,
+// so different tag sets never share a key. Null and missing tags are both left out of the written entry,
+// so they share the same key.
+func buildSeriesKey(tags map[string]Value) string {
+	names := make([]string, 0, len(tags))
+	for name, value := range tags {
+		if !value.IsNull() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var key strings.Builder
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	writeLengthPrefixed := func(s string) {
+		n := binary.PutUvarint(lenBuf, uint64(len(s)))
+		key.Write(lenBuf[:n])
+		key.WriteString(s)
+	}
+	for _, name := range names {
+		writeLengthPrefixed(name)
+		writeLengthPrefixed(tags[name].StringValue())
+	}
+	return key.String()
+}
+
 func buildPbValue(v Value) (*storagepb.Value, error) {
 	switch v.DataType() {
 	case BOOL:
@@ -372,6 +692,12 @@ func buildPbValue(v Value) (*storagepb.Value, error) {
 				Uint8Value: uint32(v.Uint8Value()),
 			},
 		}, nil
+	case TIMESTAMP:
+		return &storagepb.Value{
+			Value: &storagepb.Value_TimestampValue{
+				TimestampValue: v.TimestampValue(),
+			},
+		}, nil
 	case VARBINARY:
 		return &storagepb.Value{
 			Value: &storagepb.Value_VarbinaryValue{
@@ -419,33 +745,26 @@ func (d *orderedNames) toOrdered() []string {
 	return order
 }
 
-func parseQueryResponse(response *storagepb.SqlQueryResponse) ([]Row, error) {
+// parseQueryResponse decodes the rows of the response, timestampType keeps the timestamp columns as
+// DataType TIMESTAMP instead of INT64.
+func parseQueryResponse(response *storagepb.SqlQueryResponse, timestampType bool) ([]Row, []ColumnSchema, error) {
 	arrowPayload, ok := response.Output.(*storagepb.SqlQueryResponse_Arrow)
 	if !ok {
-		return nil, ErrOnlyArrowSupport
+		return nil, nil, ErrOnlyArrowSupport
 	}
 	if len(arrowPayload.Arrow.RecordBatches) == 0 {
-		return nil, ErrNullRows
+		return nil, nil, ErrNullRows
 	}
 
+	var schema *rowSchema
 	rowCount := 0
 	rowBatches := make([][]Row, 0, len(arrowPayload.Arrow.RecordBatches))
 	for _, batch := range arrowPayload.Arrow.RecordBatches {
-		buffer := io.Reader(bytes.NewReader(batch))
-
-		if arrowPayload.Arrow.Compression == storagepb.ArrowPayload_ZSTD {
-			zstdReader, err := zstd.NewReader(buffer)
-			if err != nil {
-				return nil, err
-			}
-			buffer = zstdReader
-		}
-
-		reader, err := ipc.NewReader(buffer)
+		reader, err := newArrowBatchReader(batch, arrowPayload.Arrow.Compression)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
-		schema := reader.Schema()
+		schema = rowSchemaOf(schema, reader.Schema(), timestampType)
 		for reader.Next() {
 			record := reader.Record()
 			rowsBatch := convertArrowRecordToRow(schema, record)
@@ -460,20 +779,117 @@ func parseQueryResponse(response *storagepb.SqlQueryResponse) ([]Row, error) {
 		rows = append(rows, rowBatch...)
 	}
 
-	return rows, nil
+	return rows, schema.columns, nil
 }
 
-func convertArrowRecordToRow(schema *arrow.Schema, record array.Record) []Row {
+var (
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+)
+
+// sharedZstdDecoder returns the decoder of all the compressed batches, a decoder keeps its goroutines until
+// it is closed so it is not created per batch. DecodeAll is safe for concurrent use.
+func sharedZstdDecoder() (*zstd.Decoder, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil)
+	})
+	return zstdDecoder, zstdDecoderErr
+}
+
+func newArrowBatchReader(batch []byte, compression storagepb.ArrowPayload_Compression) (*ipc.Reader, error) {
+	if compression == storagepb.ArrowPayload_ZSTD {
+		decoder, err := sharedZstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		if batch, err = decoder.DecodeAll(batch, nil); err != nil {
+			return nil, fmt.Errorf("decode zstd batch: %w", err)
+		}
+	}
+
+	return ipc.NewReader(bytes.NewReader(batch))
+}
+
+// rowSchemaOf reuses the last schema if the columns don't change, so that its cached lookups are kept.
+func rowSchemaOf(last *rowSchema, schema *arrow.Schema, timestampType bool) *rowSchema {
+	columns := make([]ColumnSchema, len(schema.Fields()))
+	for idx, field := range schema.Fields() {
+		columns[idx] = ColumnSchema{
+			Name:     field.Name,
+			DataType: convertArrowDataType(field.Type, timestampType),
+			Nullable: field.Nullable,
+		}
+	}
+	if last.sameColumns(columns) {
+		return last
+	}
+	return newRowSchema(columns)
+}
+
+// convertArrowDataType maps the Arrow type to the DataType of the values converted from it.
+func convertArrowDataType(dataType arrow.DataType, timestampType bool) DataType {
+	switch dataType.ID() {
+	case arrow.STRING:
+		return STRING
+	case arrow.FLOAT64:
+		return DOUBLE
+	case arrow.FLOAT32:
+		return FLOAT
+	case arrow.INT64:
+		return INT64
+	case arrow.INT32:
+		return INT32
+	case arrow.INT16:
+		return INT16
+	case arrow.INT8:
+		return INT8
+	case arrow.UINT64:
+		return UINT64
+	case arrow.UINT32:
+		return UINT32
+	case arrow.UINT16:
+		return UINT16
+	case arrow.UINT8:
+		return UINT8
+	case arrow.BOOL:
+		return BOOL
+	case arrow.BINARY:
+		return VARBINARY
+	case arrow.TIMESTAMP:
+		if timestampType {
+			return TIMESTAMP
+		}
+		return INT64
+	default:
+		return NULL
+	}
+}
+
+// timestampMillis converts a timestamp of the Arrow unit into milliseconds.
+func timestampMillis(v arrow.Timestamp, unit arrow.TimeUnit) int64 {
+	switch unit {
+	case arrow.Second:
+		return int64(v) * 1000
+	case arrow.Microsecond:
+		return int64(v) / 1000
+	case arrow.Nanosecond:
+		return int64(v) / 1000000
+	default:
+		return int64(v)
+	}
+}
+
+func convertArrowRecordToRow(schema *rowSchema, record array.Record) []Row {
 	rows := make([]Row, record.NumRows())
 	for rowIdx := range rows {
 		rows[rowIdx] = Row{
+			schema: schema,
 			values: make([]Value, record.NumCols()),
 		}
 	}
 
-	fields := make([]string, len(schema.Fields()))
-	for colIdx, field := range schema.Fields() {
-		fields[colIdx] = field.Name
+	for colIdx := range schema.fields {
 		column := record.Column(colIdx)
 		switch column.DataType().ID() {
 		case arrow.STRING:
@@ -595,20 +1011,23 @@ func convertArrowRecordToRow(schema *arrow.Schema, record array.Record) []Row {
 			}
 		case arrow.TIMESTAMP:
 			colTimestamp := column.(*array.Timestamp)
+			unit := colTimestamp.DataType().(*arrow.TimestampType).Unit
+			asTimestamp := schema.columns[colIdx].DataType == TIMESTAMP
 			for rowIdx := 0; rowIdx < colTimestamp.Len(); rowIdx++ {
-				if colTimestamp.IsNull(rowIdx) {
+				switch {
+				case colTimestamp.IsNull(rowIdx) && asTimestamp:
+					rows[rowIdx].values[colIdx] = NewTimestampNullValue()
+				case colTimestamp.IsNull(rowIdx):
 					rows[rowIdx].values[colIdx] = NewInt64NullValue()
-				} else {
-					rows[rowIdx].values[colIdx] = NewInt64Value(int64(colTimestamp.Value(rowIdx)))
+				case asTimestamp:
+					rows[rowIdx].values[colIdx] = NewTimestampValue(timestampMillis(colTimestamp.Value(rowIdx), unit))
+				default:
+					rows[rowIdx].values[colIdx] = NewInt64Value(timestampMillis(colTimestamp.Value(rowIdx), unit))
 				}
 			}
 		default:
 		}
 	}
 
-	for rowIdx := range rows {
-		rows[rowIdx].fields = fields
-	}
-
 	return rows
 }
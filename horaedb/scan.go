@@ -0,0 +1,292 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const structTagName = "horaedb"
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// scanPlan maps the columns of a schema to the fields of a struct type.
+type scanPlan struct {
+	columns []int   // column index of every mapped field
+	fields  [][]int // field index path of every mapped field
+	names   []string
+}
+
+// Scan copies the columns of the row into the struct pointed by dest. A field is filled by the column named
+// in its `horaedb:"col"` tag, or by the column with the name of the field, case-insensitively, if it has no tag.
+// `horaedb:"-"` skips the field. Fields without a matching column are left untouched.
+//
+// Integers and floats are converted between widths when the value fits, timestamps can be scanned into
+// time.Time or integers, and nulls set pointer fields to nil and the other fields to their zero value.
+// Fields implementing sql.Scanner are scanned by it.
+func (r Row) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.Wrapf(ErrScanDest, "want pointer to struct, got %T", dest)
+	}
+	return r.scanStruct(v.Elem())
+}
+
+// Scan copies all the rows into dest, which is a pointer to a slice of structs or of pointers to structs.
+// See Row.Scan for how the columns are mapped.
+func (r SQLQueryResponse) Scan(dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return errors.Wrapf(ErrScanDest, "want pointer to slice, got %T", dest)
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return errors.Wrapf(ErrScanDest, "want slice of structs, got %T", dest)
+	}
+
+	ret := reflect.MakeSlice(slice.Type(), 0, len(r.Rows))
+	for idx, row := range r.Rows {
+		elem := reflect.New(structType)
+		if err := row.scanStruct(elem.Elem()); err != nil {
+			return errors.Wrapf(err, "scan row %d", idx)
+		}
+		if isPtr {
+			ret = reflect.Append(ret, elem)
+		} else {
+			ret = reflect.Append(ret, elem.Elem())
+		}
+	}
+	slice.Set(ret)
+	return nil
+}
+
+func (r Row) scanStruct(dest reflect.Value) error {
+	if r.schema == nil {
+		return nil
+	}
+
+	plan := r.schema.scanPlanOf(dest.Type())
+	for idx, colIdx := range plan.columns {
+		field := dest.FieldByIndex(plan.fields[idx])
+		if err := setFieldValue(field, r.values[colIdx]); err != nil {
+			return errors.Wrapf(err, "scan column %s into field %s", r.schema.fields[colIdx], plan.names[idx])
+		}
+	}
+	return nil
+}
+
+func (s *rowSchema) scanPlanOf(typ reflect.Type) *scanPlan {
+	if plan, ok := s.plans.Load(typ); ok {
+		return plan.(*scanPlan)
+	}
+
+	plan := &scanPlan{}
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		tagName := strings.Split(field.Tag.Get(structTagName), ",")[0]
+		if tagName == "-" {
+			continue
+		}
+
+		var colIdx int
+		var ok bool
+		if tagName != "" {
+			colIdx, ok = s.indexes[tagName]
+		} else if colIdx, ok = s.indexes[field.Name]; !ok {
+			colIdx, ok = s.foldIndexes[strings.ToLower(field.Name)]
+		}
+		if !ok {
+			continue
+		}
+		plan.columns = append(plan.columns, colIdx)
+		plan.fields = append(plan.fields, field.Index)
+		plan.names = append(plan.names, field.Name)
+	}
+
+	actual, _ := s.plans.LoadOrStore(typ, plan)
+	return actual.(*scanPlan)
+}
+
+func setFieldValue(field reflect.Value, value Value) error {
+	if field.CanAddr() && field.Addr().Type().Implements(scannerType) {
+		return field.Addr().Interface().(sql.Scanner).Scan(value.AnyValue())
+	}
+
+	if value.IsNull() {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	if field.Kind() == reflect.Ptr {
+		elem := reflect.New(field.Type().Elem())
+		if err := setFieldValue(elem.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(elem)
+		return nil
+	}
+
+	if field.Type() == timeType {
+		ms, ok := integerValue(value)
+		if !ok || value.DataType() == UINT64 {
+			return mismatchError(field, value)
+		}
+		field.Set(reflect.ValueOf(time.UnixMilli(ms)))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.Interface:
+		field.Set(reflect.ValueOf(value.AnyValue()))
+		return nil
+	case reflect.Int, reflect.Int64, reflect.Int32, reflect.Int16, reflect.Int8:
+		if value.DataType() == UINT64 {
+			v := value.Uint64Value()
+			if v > uint64(1<<63-1) || field.OverflowInt(int64(v)) {
+				return overflowError(field, value)
+			}
+			field.SetInt(int64(v))
+			return nil
+		}
+		v, ok := integerValue(value)
+		if !ok {
+			return mismatchError(field, value)
+		}
+		if field.OverflowInt(v) {
+			return overflowError(field, value)
+		}
+		field.SetInt(v)
+		return nil
+	case reflect.Uint, reflect.Uint64, reflect.Uint32, reflect.Uint16, reflect.Uint8:
+		if value.DataType() == UINT64 {
+			if field.OverflowUint(value.Uint64Value()) {
+				return overflowError(field, value)
+			}
+			field.SetUint(value.Uint64Value())
+			return nil
+		}
+		v, ok := integerValue(value)
+		if !ok {
+			return mismatchError(field, value)
+		}
+		if v < 0 || field.OverflowUint(uint64(v)) {
+			return overflowError(field, value)
+		}
+		field.SetUint(uint64(v))
+		return nil
+	case reflect.Float64, reflect.Float32:
+		var v float64
+		switch value.DataType() {
+		case DOUBLE:
+			v = value.DoubleValue()
+		case FLOAT:
+			v = float64(value.FloatValue())
+		case UINT64:
+			v = float64(value.Uint64Value())
+		default:
+			i, ok := integerValue(value)
+			if !ok {
+				return mismatchError(field, value)
+			}
+			v = float64(i)
+		}
+		if field.OverflowFloat(v) {
+			return overflowError(field, value)
+		}
+		field.SetFloat(v)
+		return nil
+	case reflect.String:
+		if value.DataType() != STRING {
+			return mismatchError(field, value)
+		}
+		field.SetString(value.StringValue())
+		return nil
+	case reflect.Bool:
+		if value.DataType() != BOOL {
+			return mismatchError(field, value)
+		}
+		field.SetBool(value.BoolValue())
+		return nil
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.Uint8 {
+			return mismatchError(field, value)
+		}
+		switch value.DataType() {
+		case VARBINARY:
+			field.SetBytes(append([]byte(nil), value.VarbinaryValue()...))
+		case STRING:
+			field.SetBytes([]byte(value.StringValue()))
+		default:
+			return mismatchError(field, value)
+		}
+		return nil
+	default:
+		return mismatchError(field, value)
+	}
+}
+
+// integerValue returns the value as int64 if it is a timestamp or an integer other than uint64.
+func integerValue(value Value) (int64, bool) {
+	switch value.DataType() {
+	case TIMESTAMP, INT64:
+		return value.Int64Value(), true
+	case INT32:
+		return int64(value.Int32Value()), true
+	case INT16:
+		return int64(value.Int16Value()), true
+	case INT8:
+		return int64(value.Int8Value()), true
+	case UINT32:
+		return int64(value.Uint32Value()), true
+	case UINT16:
+		return int64(value.Uint16Value()), true
+	case UINT8:
+		return int64(value.Uint8Value()), true
+	default:
+		return 0, false
+	}
+}
+
+func mismatchError(field reflect.Value, value Value) error {
+	return errors.Wrapf(ErrScanTypeMismatch, "can't scan %s into %s", value.DataType(), field.Type())
+}
+
+func overflowError(field reflect.Value, value Value) error {
+	return errors.Wrapf(ErrScanTypeMismatch, "value %v of %s overflows %s", value.AnyValue(), value.DataType(), field.Type())
+}
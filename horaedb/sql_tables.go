@@ -0,0 +1,419 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"strings"
+)
+
+type sqlTokenKind int
+
+const (
+	tokenWord   sqlTokenKind = iota
+	tokenQuoted              // "ident" or `ident`
+	tokenString              // 'literal'
+	tokenNumber
+	tokenSymbol
+)
+
+type sqlToken struct {
+	kind       sqlTokenKind
+	text       string // identifiers are unquoted, keywords keep their case
+	start, end int    // byte offsets in the sql
+}
+
+func (t sqlToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (t sqlToken) isSymbol(symbol string) bool {
+	return t.kind == tokenSymbol && t.text == symbol
+}
+
+func (t sqlToken) isIdent() bool {
+	return t.kind == tokenWord || t.kind == tokenQuoted
+}
+
+// tokenizeSQL splits the sql into tokens, skipping whitespace and comments. Unterminated quotes and
+// comments run to the end of the sql.
+func tokenizeSQL(sql string) []sqlToken {
+	var tokens []sqlToken
+	for pos := 0; pos < len(sql); {
+		c := sql[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			pos++
+		case strings.HasPrefix(sql[pos:], "--"):
+			end := strings.IndexByte(sql[pos:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			pos += end + 1
+		case strings.HasPrefix(sql[pos:], "/*"):
+			end := strings.Index(sql[pos+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			pos += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			text, next := readQuoted(sql, pos)
+			kind := tokenQuoted
+			if c == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: text, start: pos, end: next})
+			pos = next
+		case isWordByte(c):
+			start := pos
+			for pos < len(sql) && isWordByte(sql[pos]) {
+				pos++
+			}
+			kind := tokenWord
+			if c >= '0' && c <= '9' {
+				kind = tokenNumber
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: sql[start:pos], start: start, end: pos})
+		default:
+			tokens = append(tokens, sqlToken{kind: tokenSymbol, text: sql[pos : pos+1], start: pos, end: pos + 1})
+			pos++
+		}
+	}
+	return tokens
+}
+
+// readQuoted reads the quoted text starting at pos, a doubled quote escapes itself.
+func readQuoted(sql string, pos int) (string, int) {
+	quote := sql[pos]
+	var b strings.Builder
+	for pos++; pos < len(sql); pos++ {
+		if sql[pos] != quote {
+			b.WriteByte(sql[pos])
+			continue
+		}
+		if pos+1 < len(sql) && sql[pos+1] == quote {
+			b.WriteByte(quote)
+			pos++
+			continue
+		}
+		return b.String(), pos + 1
+	}
+	return b.String(), pos
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// clauseKeywords end a table reference, so they are never taken as its alias.
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true,
+	"CROSS": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true, "HAVING": true,
+	"LIMIT": true, "OFFSET": true, "UNION": true, "EXCEPT": true, "INTERSECT": true, "WINDOW": true,
+	"SELECT": true, "VALUES": true, "SET": true, "ADD": true, "MODIFY": true, "DROP": true, "RENAME": true,
+	"ENGINE": true, "WITH": true, "PARTITION": true, "LIKE": true, "FROM": true, "INTO": true,
+}
+
+// sqlTableExtractor walks the tokens of a sql and collects the tables it references.
+type sqlParen struct {
+	query bool
+	cte   bool
+}
+
+type sqlTableExtractor struct {
+	tokens []sqlToken
+	pos    int
+	// parens are the open parens, FROM inside EXTRACT(... FROM ...) is not a table.
+	parens []sqlParen
+	// cteBody is set when the next paren is the body of a CTE, which may be followed by another CTE.
+	cteBody bool
+	ctes    map[string]bool
+	tables  []string
+	seen    map[string]bool
+}
+
+// ExtractTables returns the tables referenced by the sql, in order of appearance and without duplicates.
+// It understands the table positions of SELECT (FROM, JOIN, subqueries and CTEs), INSERT, CREATE, DROP,
+// ALTER, DESCRIBE, EXISTS and SHOW CREATE TABLE statements, and both "quoted" and `quoted` identifiers.
+// A qualified name contributes its last part. The sql is not validated, nil is returned when no table is found.
+func ExtractTables(sql string) []string {
+	e := &sqlTableExtractor{
+		tokens: tokenizeSQL(sql),
+		ctes:   make(map[string]bool),
+		seen:   make(map[string]bool),
+	}
+	e.extract()
+
+	var tables []string
+	for _, table := range e.tables {
+		if !e.ctes[table] {
+			tables = append(tables, table)
+		}
+	}
+	return tables
+}
+
+func (e *sqlTableExtractor) peek(offset int) (sqlToken, bool) {
+	if e.pos+offset >= len(e.tokens) {
+		return sqlToken{}, false
+	}
+	return e.tokens[e.pos+offset], true
+}
+
+func (e *sqlTableExtractor) peekKeyword(offset int, keyword string) bool {
+	token, ok := e.peek(offset)
+	return ok && token.isKeyword(keyword)
+}
+
+func (e *sqlTableExtractor) peekSymbol(offset int, symbol string) bool {
+	token, ok := e.peek(offset)
+	return ok && token.isSymbol(symbol)
+}
+
+func (e *sqlTableExtractor) inQuery() bool {
+	return len(e.parens) == 0 || e.parens[len(e.parens)-1].query
+}
+
+func (e *sqlTableExtractor) extract() {
+	statementStart := true
+	for e.pos < len(e.tokens) {
+		token := e.tokens[e.pos]
+		atStart := statementStart
+		statementStart = false
+		e.pos++
+
+		switch {
+		case token.isSymbol(";"):
+			statementStart = true
+			e.parens = e.parens[:0]
+		case token.isSymbol("("):
+			e.parens = append(e.parens, sqlParen{
+				query: e.peekKeyword(0, "SELECT") || e.peekKeyword(0, "WITH"),
+				cte:   e.cteBody,
+			})
+			e.cteBody = false
+		case token.isSymbol(")"):
+			if len(e.parens) == 0 {
+				continue
+			}
+			paren := e.parens[len(e.parens)-1]
+			e.parens = e.parens[:len(e.parens)-1]
+			if paren.cte && e.peekSymbol(0, ",") {
+				e.pos++
+				e.readCTEName()
+			}
+		case token.isKeyword("WITH") && e.inQuery():
+			e.readCTEName()
+		case token.isKeyword("FROM") && e.inQuery() && !e.previousIs("DISTINCT"):
+			e.readTableList()
+		case token.isKeyword("JOIN"):
+			e.readTableRef()
+		case token.isKeyword("INTO"):
+			e.readTableName(true)
+		case token.isKeyword("TABLE"):
+			e.skipIfExists()
+			for e.readTableName(true) && e.peekSymbol(0, ",") {
+				e.pos++
+			}
+		case atStart && (token.isKeyword("DESCRIBE") || token.isKeyword("DESC") || token.isKeyword("EXISTS")):
+			if e.peekKeyword(0, "TABLE") {
+				e.pos++
+			}
+			e.readTableName(false)
+		}
+	}
+}
+
+// readCTEName reads name [(columns)] AS of a CTE, the paren after it is the body.
+func (e *sqlTableExtractor) readCTEName() {
+	if e.peekKeyword(0, "RECURSIVE") {
+		e.pos++
+	}
+	token, ok := e.peek(0)
+	if !ok || !token.isIdent() {
+		return
+	}
+	e.ctes[token.text] = true
+	e.pos++
+	if e.peekSymbol(0, "(") {
+		e.skipParens()
+	}
+	if e.peekKeyword(0, "AS") && e.peekSymbol(1, "(") {
+		e.pos++
+		e.cteBody = true
+	}
+}
+
+// matchingParen returns the index of the paren closing the one at open, or -1.
+func (e *sqlTableExtractor) matchingParen(open int) int {
+	depth := 0
+	for idx := open; idx < len(e.tokens); idx++ {
+		switch {
+		case e.tokens[idx].isSymbol("("):
+			depth++
+		case e.tokens[idx].isSymbol(")"):
+			depth--
+			if depth == 0 {
+				return idx
+			}
+		}
+	}
+	return -1
+}
+
+func (e *sqlTableExtractor) skipParens() {
+	end := e.matchingParen(e.pos)
+	if end < 0 {
+		e.pos = len(e.tokens)
+		return
+	}
+	e.pos = end + 1
+}
+
+// previousIs reports whether the token before the current one is the keyword.
+func (e *sqlTableExtractor) previousIs(keyword string) bool {
+	return e.pos >= 2 && e.tokens[e.pos-2].isKeyword(keyword)
+}
+
+func (e *sqlTableExtractor) skipIfExists() {
+	switch {
+	case e.peekKeyword(0, "IF") && e.peekKeyword(1, "EXISTS"):
+		e.pos += 2
+	case e.peekKeyword(0, "IF") && e.peekKeyword(1, "NOT") && e.peekKeyword(2, "EXISTS"):
+		e.pos += 3
+	}
+}
+
+// readTableList reads table references separated by commas.
+func (e *sqlTableExtractor) readTableList() {
+	for e.readTableRef() && e.peekSymbol(0, ",") {
+		e.pos++
+	}
+}
+
+// readTableRef reads a table name or a subquery, with an optional alias. It returns false if there is neither.
+func (e *sqlTableExtractor) readTableRef() bool {
+	if e.peekKeyword(0, "LATERAL") {
+		e.pos++
+	}
+	if e.peekSymbol(0, "(") {
+		// A subquery is walked by extract, skip to the alias after it.
+		end := e.matchingParen(e.pos)
+		if end < 0 {
+			return false
+		}
+		e.walkRange(e.pos, end+1)
+		e.pos = end + 1
+	} else if !e.readTableName(false) {
+		return false
+	}
+
+	if e.peekKeyword(0, "AS") {
+		e.pos += 2
+		return true
+	}
+	if token, ok := e.peek(0); ok && (token.kind == tokenQuoted || token.kind == tokenWord && !clauseKeywords[strings.ToUpper(token.text)]) {
+		e.pos++
+	}
+	return true
+}
+
+// walkRange extracts the tables of the tokens in [start, end) with a nested extractor.
+func (e *sqlTableExtractor) walkRange(start, end int) {
+	nested := &sqlTableExtractor{
+		tokens: e.tokens[start:end],
+		ctes:   e.ctes,
+		seen:   e.seen,
+	}
+	nested.extract()
+	e.tables = append(e.tables, nested.tables...)
+}
+
+// readTableName reads a possibly qualified name and adds its last part. A paren after the name is a column
+// list if columns is set, otherwise the name is a table function and is not added.
+func (e *sqlTableExtractor) readTableName(columns bool) bool {
+	token, ok := e.peek(0)
+	if !ok || !token.isIdent() || token.kind == tokenWord && clauseKeywords[strings.ToUpper(token.text)] {
+		return false
+	}
+	name := token.text
+	e.pos++
+	for e.peekSymbol(0, ".") {
+		next, ok := e.peek(1)
+		if !ok || !next.isIdent() {
+			break
+		}
+		name = next.text
+		e.pos += 2
+	}
+
+	if !columns && e.peekSymbol(0, "(") {
+		e.skipParens()
+		return true
+	}
+	e.addTable(name)
+	return true
+}
+
+func (e *sqlTableExtractor) addTable(name string) {
+	if e.seen[name] {
+		return
+	}
+	e.seen[name] = true
+	e.tables = append(e.tables, name)
+}
+
+// splitUnionAll splits a sql of the form `q1 UNION ALL q2 ...` into its queries. ok is false unless there are
+// at least two queries and the result of the sql is just their rows put together, so UNION without ALL,
+// INTERSECT, EXCEPT, a WITH shared by the queries, several statements, or ORDER BY, LIMIT and OFFSET outside
+// of parens make it false.
+func splitUnionAll(sql string) (queries []string, ok bool) {
+	tokens := tokenizeSQL(sql)
+	for len(tokens) > 0 && tokens[len(tokens)-1].isSymbol(";") {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 || tokens[0].isKeyword("WITH") {
+		return nil, false
+	}
+
+	depth, start := 0, 0
+	for idx, token := range tokens {
+		switch {
+		case token.isSymbol("("):
+			depth++
+		case token.isSymbol(")"):
+			depth--
+		case depth > 0:
+		case token.isSymbol(";"), token.isKeyword("INTERSECT"), token.isKeyword("EXCEPT"), token.isKeyword("MINUS"),
+			token.isKeyword("ORDER"), token.isKeyword("LIMIT"), token.isKeyword("OFFSET"), token.isKeyword("FETCH"):
+			return nil, false
+		case token.isKeyword("UNION"):
+			if idx == start || idx+2 >= len(tokens) || !tokens[idx+1].isKeyword("ALL") {
+				return nil, false
+			}
+			queries = append(queries, sql[tokens[start].start:tokens[idx-1].end])
+			start = idx + 2
+		}
+	}
+	if len(queries) == 0 {
+		return nil, false
+	}
+	return append(queries, sql[tokens[start].start:tokens[len(tokens)-1].end]), true
+}
@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrTxNotSupported   = errors.New("horaedb: transactions are not supported")
+	ErrArgsNotSupported = errors.New("horaedb: query arguments are not supported, only a Tables hint")
+)
+
+// TablesHint is the tables a statement reads or writes, see Tables.
+type TablesHint []string
+
+// Tables passes the tables of a statement as an argument of Exec or Query, instead of deriving them from the SQL:
+//
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM demo", sqldriver.Tables("demo"))
+func Tables(tables ...string) TablesHint {
+	return tables
+}
+
+type conn struct {
+	client horaedb.Client
+	// connector is only set for the conns of Driver.Open, which own their client.
+	connector *Connector
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	if c.connector != nil {
+		return c.connector.Close()
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrTxNotSupported
+}
+
+// CheckNamedValue keeps the Tables hint as is, other arguments are rejected by Exec and Query.
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if _, ok := v.Value.(TablesHint); ok {
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	resp, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(resp.AffectedRows), nil
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	resp, err := c.query(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(resp), nil
+}
+
+func (c *conn) query(ctx context.Context, query string, args []driver.NamedValue) (horaedb.SQLQueryResponse, error) {
+	var tables []string
+	for _, arg := range args {
+		hint, ok := arg.Value.(TablesHint)
+		if !ok {
+			return horaedb.SQLQueryResponse{}, ErrArgsNotSupported
+		}
+		tables = append(tables, hint...)
+	}
+	resp, err := c.client.SQLQuery(ctx, horaedb.SQLQueryRequest{
+		Tables: tables,
+		SQL:    query,
+	})
+	if errors.Is(err, horaedb.ErrNullRows) {
+		// The server sends no batch, so no schema either, for a result without rows.
+		return horaedb.SQLQueryResponse{SQL: query}, nil
+	}
+	return resp, err
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput is unknown since the Tables hint is optional.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func (s *stmt) CheckNamedValue(v *driver.NamedValue) error {
+	return s.conn.CheckNamedValue(v)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for idx, arg := range args {
+		named[idx] = driver.NamedValue{Ordinal: idx + 1, Value: arg}
+	}
+	return named
+}
@@ -0,0 +1,103 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+// Package sqldriver is a database/sql driver for HoraeDB, registered as "horaedb":
+//
+//	db, err := sql.Open("horaedb", "horaedb://127.0.0.1:8831/public?route_mode=proxy")
+//
+// See ParseDSN for the format of the DSN. HoraeDB has no transactions and no placeholders, so Begin
+// fails and the only accepted argument is a Tables hint, which routes the query to the tables. Without
+// it the tables are derived from the SQL.
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+)
+
+const driverName = "horaedb"
+
+func init() {
+	sql.Register(driverName, &Driver{})
+}
+
+// Driver implements driver.Driver and driver.DriverContext.
+type Driver struct{}
+
+// Open opens a conn with a client of its own, which is closed with the conn. sql.DB uses OpenConnector
+// instead, whose conns share one client.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	c, err := connector.Connect(context.Background())
+	if err != nil {
+		_ = connector.(*Connector).Close()
+		return nil, err
+	}
+	c.(*conn).connector = connector.(*Connector)
+	return c, nil
+}
+
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewConnector(cfg)
+}
+
+// Connector creates conns sharing one client, it is closed by sql.DB.Close.
+type Connector struct {
+	client horaedb.Client
+}
+
+// NewConnector creates the client of the config, use it with sql.OpenDB.
+func NewConnector(cfg *Config) (*Connector, error) {
+	// Timestamp columns are returned as time.Time.
+	opts := append([]horaedb.Option{horaedb.WithTimestampDataType(true)}, cfg.Options...)
+	if cfg.Database != "" {
+		opts = append([]horaedb.Option{horaedb.WithDefaultDatabase(cfg.Database)}, opts...)
+	}
+	client, err := horaedb.NewClientWithEndpoints(cfg.Endpoints, cfg.RouteMode, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{
+		client: client,
+	}, nil
+}
+
+func (c *Connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{
+		client: c.client,
+	}, nil
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+func (c *Connector) Close() error {
+	return c.client.Close(context.Background())
+}
@@ -0,0 +1,149 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sqldriver
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/pkg/errors"
+)
+
+const dsnScheme = "horaedb"
+
+// Config is the client config parsed from a DSN.
+type Config struct {
+	Endpoints []string
+	RouteMode horaedb.RouteMode
+	Database  string
+	Options   []horaedb.Option
+}
+
+// ParseDSN parses a DSN of the form:
+//
+//	horaedb://host:port[,host:port...][/database][?param=value&...]
+//
+// The params are:
+//
+//	route_mode         direct (default) or proxy
+//	query_timeout      limit of every query without deadline, e.g. 5s
+//	route_timeout      limit of every route RPC without deadline
+//	route_ttl          expiration of cached routes
+//	max_recv_msg_size  max size in bytes of a received message
+//	tls                true to connect with TLS
+//	tls_ca_file        PEM CA bundle to verify servers, enables TLS
+//	tls_cert_file      PEM client certificate for mutual TLS, with tls_key_file
+//	tls_key_file       PEM client key for mutual TLS, with tls_cert_file
+//	tls_server_name    server name to verify, enables TLS
+func ParseDSN(dsn string) (*Config, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse dsn")
+	}
+	if u.Scheme != dsnScheme {
+		return nil, fmt.Errorf("invalid dsn scheme %q, want %s", u.Scheme, dsnScheme)
+	}
+
+	cfg := &Config{
+		RouteMode: horaedb.Direct,
+		Database:  strings.Trim(u.Path, "/"),
+	}
+	for _, endpoint := range strings.Split(u.Host, ",") {
+		if endpoint != "" {
+			cfg.Endpoints = append(cfg.Endpoints, endpoint)
+		}
+	}
+	if len(cfg.Endpoints) == 0 {
+		return nil, errors.Wrap(horaedb.ErrNoEndpoints, "parse dsn")
+	}
+	if strings.Contains(cfg.Database, "/") {
+		return nil, fmt.Errorf("invalid dsn database %q", cfg.Database)
+	}
+
+	params := u.Query()
+	var certFile, keyFile string
+	for key, values := range params {
+		value := values[len(values)-1]
+		switch key {
+		case "route_mode":
+			switch strings.ToLower(value) {
+			case "direct":
+				cfg.RouteMode = horaedb.Direct
+			case "proxy":
+				cfg.RouteMode = horaedb.Proxy
+			default:
+				return nil, fmt.Errorf("invalid dsn param %s=%s, want direct or proxy", key, value)
+			}
+		case "query_timeout", "route_timeout", "route_ttl":
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid dsn param %s", key)
+			}
+			cfg.Options = append(cfg.Options, durationOption(key, d))
+		case "max_recv_msg_size":
+			size, err := strconv.Atoi(value)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("invalid dsn param %s=%s, want positive integer", key, value)
+			}
+			cfg.Options = append(cfg.Options, horaedb.WithRPCMaxRecvMsgSize(size))
+		case "tls":
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid dsn param %s", key)
+			}
+			if enabled {
+				cfg.Options = append(cfg.Options, horaedb.WithTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+			}
+		case "tls_ca_file":
+			cfg.Options = append(cfg.Options, horaedb.WithTLSCAFile(value))
+		case "tls_server_name":
+			cfg.Options = append(cfg.Options, horaedb.WithTLSServerName(value))
+		case "tls_cert_file":
+			certFile = value
+		case "tls_key_file":
+			keyFile = value
+		default:
+			return nil, fmt.Errorf("unknown dsn param %s", key)
+		}
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("invalid dsn params, tls_cert_file and tls_key_file must be set together")
+	}
+	if certFile != "" {
+		cfg.Options = append(cfg.Options, horaedb.WithTLSClientCertFile(certFile, keyFile))
+	}
+	return cfg, nil
+}
+
+func durationOption(key string, d time.Duration) horaedb.Option {
+	switch key {
+	case "query_timeout":
+		return horaedb.WithQueryTimeout(d)
+	case "route_timeout":
+		return horaedb.WithRouteTimeout(d)
+	default:
+		return horaedb.WithRouteTTL(d)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package sqldriver
+
+import (
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+)
+
+// scanTypes are the types returned by driverValue for every DataType.
+var scanTypes = map[horaedb.DataType]reflect.Type{
+	horaedb.TIMESTAMP: reflect.TypeOf(time.Time{}),
+	horaedb.STRING:    reflect.TypeOf(""),
+	horaedb.DOUBLE:    reflect.TypeOf(float64(0)),
+	horaedb.FLOAT:     reflect.TypeOf(float64(0)),
+	horaedb.INT64:     reflect.TypeOf(int64(0)),
+	horaedb.INT32:     reflect.TypeOf(int64(0)),
+	horaedb.INT16:     reflect.TypeOf(int64(0)),
+	horaedb.INT8:      reflect.TypeOf(int64(0)),
+	horaedb.UINT64:    reflect.TypeOf(uint64(0)),
+	horaedb.UINT32:    reflect.TypeOf(int64(0)),
+	horaedb.UINT16:    reflect.TypeOf(int64(0)),
+	horaedb.UINT8:     reflect.TypeOf(int64(0)),
+	horaedb.BOOL:      reflect.TypeOf(false),
+	horaedb.VARBINARY: reflect.TypeOf([]byte(nil)),
+}
+
+var anyType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// rows implements driver.Rows and the column type interfaces over a query response.
+type rows struct {
+	schema []horaedb.ColumnSchema
+	rows   []horaedb.Row
+	next   int
+}
+
+func newRows(resp horaedb.SQLQueryResponse) *rows {
+	return &rows{
+		schema: resp.Schema,
+		rows:   resp.Rows,
+	}
+}
+
+func (r *rows) Columns() []string {
+	columns := make([]string, len(r.schema))
+	for idx, column := range r.schema {
+		columns[idx] = column.Name
+	}
+	return columns
+}
+
+func (r *rows) Close() error {
+	r.rows = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.next]
+	r.next++
+
+	for idx, column := range row.Columns() {
+		if idx < len(dest) {
+			dest[idx] = driverValue(column.Value())
+		}
+	}
+	return nil
+}
+
+// ColumnTypeDatabaseTypeName returns the name of the HoraeDB DataType, e.g. TIMESTAMP or STRING.
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return r.schema[index].DataType.String()
+}
+
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	if typ, ok := scanTypes[r.schema[index].DataType]; ok {
+		return typ
+	}
+	return anyType
+}
+
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return r.schema[index].Nullable, true
+}
+
+// driverValue converts the value to the types of driver.Value, except that UINT64 stays uint64 to keep its range.
+func driverValue(value horaedb.Value) driver.Value {
+	if value.IsNull() {
+		return nil
+	}
+
+	switch value.DataType() {
+	case horaedb.TIMESTAMP:
+		return time.UnixMilli(value.TimestampValue())
+	case horaedb.STRING:
+		return value.StringValue()
+	case horaedb.DOUBLE:
+		return value.DoubleValue()
+	case horaedb.FLOAT:
+		return float64(value.FloatValue())
+	case horaedb.INT64:
+		return value.Int64Value()
+	case horaedb.INT32:
+		return int64(value.Int32Value())
+	case horaedb.INT16:
+		return int64(value.Int16Value())
+	case horaedb.INT8:
+		return int64(value.Int8Value())
+	case horaedb.UINT64:
+		return value.Uint64Value()
+	case horaedb.UINT32:
+		return int64(value.Uint32Value())
+	case horaedb.UINT16:
+		return int64(value.Uint16Value())
+	case horaedb.UINT8:
+		return int64(value.Uint8Value())
+	case horaedb.BOOL:
+		return value.BoolValue()
+	case horaedb.VARBINARY:
+		return value.VarbinaryValue()
+	default:
+		return value.AnyValue()
+	}
+}
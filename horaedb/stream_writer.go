@@ -0,0 +1,269 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/pkg/errors"
+)
+
+type endpointStream struct {
+	stream storagepb.StorageService_StreamWriteClient
+	tables map[string]struct{}
+	points int // points sent on this stream
+}
+
+// StreamWriter pushes points through one write stream per endpoint,
+// the server only answers once when the writer is closed.
+type StreamWriter struct {
+	client *clientImpl
+	ctx    context.Context
+	reqCtx RequestContext
+
+	mutex   sync.Mutex
+	streams map[string]*endpointStream // endpoint -> stream
+	ret     WriteResponse
+	closed  bool
+}
+
+// StreamWrite opens a StreamWriter, it counts as an inflight request of the client until it is closed.
+func (c *clientImpl) StreamWrite(ctx context.Context, reqCtx RequestContext) (*StreamWriter, error) {
+	if err := c.withDefaultRequestContext(&reqCtx); err != nil {
+		return nil, errors.Wrap(err, "add request ctx")
+	}
+
+	if err := c.acquire(); err != nil {
+		return nil, err
+	}
+
+	return &StreamWriter{
+		client:  c,
+		ctx:     ctx,
+		reqCtx:  reqCtx,
+		streams: make(map[string]*endpointStream),
+	}, nil
+}
+
+// Write routes the points and sends them to the streams of their endpoints.
+// Points routed to a new endpoint open a new stream, points sent to a broken stream are routed and sent once more.
+func (w *StreamWriter) Write(points []Point) error {
+	if len(points) == 0 {
+		return ErrNullRows
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return ErrStreamWriterClosed
+	}
+
+	if err := w.client.limiter.wait(w.ctx, points); err != nil {
+		return err
+	}
+
+	defer w.closeUnroutedStreamsLocked()
+
+	failed, err := w.sendByRouteLocked(points)
+	if err != nil || len(failed) == 0 {
+		return err
+	}
+	if w.ctx.Err() != nil {
+		return errors.Wrap(w.ctx.Err(), "stream write canceled")
+	}
+
+	failed, err = w.sendByRouteLocked(failed)
+	if err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		return errors.Wrapf(ErrStreamBroken, "resend %d points", len(failed))
+	}
+	return nil
+}
+
+// sendByRouteLocked returns the points which failed to send because their stream was broken.
+func (w *StreamWriter) sendByRouteLocked(points []Point) ([]Point, error) {
+	routes, err := w.client.routeClient.RouteFor(w.ctx, w.reqCtx, getTablesFromPoints(points))
+	if err != nil {
+		return nil, errors.Wrap(err, "route table")
+	}
+
+	pointsByRoute, err := splitPointsByRoute(points, routes)
+	if err != nil {
+		return nil, errors.Wrap(err, "split points by route")
+	}
+
+	var failed []Point
+	for endpoint, endpointPoints := range pointsByRoute {
+		stream, err := w.openStreamLocked(endpoint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "open write stream, endpoint:%s", endpoint)
+		}
+
+		opts := w.client.rpcClient.opts
+		chunks := splitPointsBySize(endpointPoints, opts.MaxRequestPoints, opts.MaxRequestBytes)
+		for idx, chunk := range chunks {
+			writeRequest, err := buildPbWriteRequest(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if err := w.sendLocked(stream, writeRequest, chunk); err != nil {
+				// The real error of a broken stream is only returned by receiving,
+				// the points sent on it before are counted as failed.
+				_ = w.closeStreamLocked(endpoint)
+				w.client.routeClient.ClearRouteFor(w.reqCtx, getTablesFromPoints(endpointPoints))
+				for _, unsent := range chunks[idx:] {
+					failed = append(failed, unsent...)
+				}
+				break
+			}
+		}
+	}
+	return failed, nil
+}
+
+// closeUnroutedStreamsLocked closes the streams whose tables all route to other endpoints now, instead of
+// keeping them open until Close. Their responses are aggregated into the response of Close.
+func (w *StreamWriter) closeUnroutedStreamsLocked() {
+	if _, ok := w.client.routeClient.(*proxyRouteClient); ok {
+		// Every proxy accepts all the tables, they only take turns between requests.
+		return
+	}
+
+	var tables []string
+	for _, stream := range w.streams {
+		for table := range stream.tables {
+			tables = append(tables, table)
+		}
+	}
+	if len(tables) == 0 {
+		return
+	}
+
+	routes, err := w.client.routeClient.RouteFor(w.ctx, w.reqCtx, tables)
+	if err != nil {
+		return
+	}
+	for endpoint, stream := range w.streams {
+		routed := false
+		for table := range stream.tables {
+			if route, ok := routes[table]; ok && route.Endpoint == endpoint {
+				routed = true
+				break
+			}
+		}
+		if !routed {
+			_ = w.closeStreamLocked(endpoint)
+		}
+	}
+}
+
+func (w *StreamWriter) sendLocked(stream *endpointStream, writeRequest *storagepb.WriteRequest, points []Point) error {
+	writeRequest.Context = &storagepb.RequestContext{
+		Database: w.reqCtx.Database,
+	}
+
+	if err := stream.stream.Send(writeRequest); err != nil {
+		return err
+	}
+
+	for _, table := range getTablesFromPoints(points) {
+		stream.tables[table] = struct{}{}
+	}
+	stream.points += len(points)
+	return nil
+}
+
+// Close closes all streams and returns the response aggregated over them.
+func (w *StreamWriter) Close() (WriteResponse, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return w.ret, nil
+	}
+	w.closed = true
+	defer w.client.release()
+
+	for endpoint := range w.streams {
+		w.closeStreamLocked(endpoint)
+	}
+
+	if w.ctx.Err() != nil {
+		return w.ret, errors.Wrap(w.ctx.Err(), "stream write canceled")
+	}
+	return w.ret, nil
+}
+
+func (w *StreamWriter) openStreamLocked(endpoint string) (*endpointStream, error) {
+	if stream, ok := w.streams[endpoint]; ok {
+		return stream, nil
+	}
+
+	stream, err := w.client.rpcClient.StreamWrite(w.ctx, endpoint, w.reqCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpointStream := &endpointStream{
+		stream: stream,
+		tables: make(map[string]struct{}),
+	}
+	w.streams[endpoint] = endpointStream
+	return endpointStream, nil
+}
+
+func (w *StreamWriter) closeStreamLocked(endpoint string) error {
+	stream, ok := w.streams[endpoint]
+	if !ok {
+		return nil
+	}
+	delete(w.streams, endpoint)
+
+	tables := make([]string, 0, len(stream.tables))
+	for table := range stream.tables {
+		tables = append(tables, table)
+	}
+	response, err := w.client.rpcClient.CloseStreamWrite(stream.stream)
+	w.client.limiter.onResult(tables, err)
+	if err != nil {
+		w.client.clearRouteOnError(w.reqCtx, endpoint, tables, err)
+
+		// The points are not kept by the stream, only the count and tables are reported.
+		w.ret = combineWriteResponse(w.ret, WriteResponse{
+			Failed:  uint32(stream.points),
+			Message: err.Error(),
+			Failures: []WriteFailure{{
+				Endpoint: endpoint,
+				Tables:   tables,
+				Code:     errorCode(err),
+				Err:      err,
+			}},
+		})
+		return err
+	}
+
+	w.ret = combineWriteResponse(w.ret, response)
+	return nil
+}
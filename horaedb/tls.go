@@ -0,0 +1,176 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package horaedb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type tlsOptions struct {
+	Config     *tls.Config
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	ServerName string
+}
+
+func (o tlsOptions) enabled() bool {
+	return o.Config != nil || o.CAFile != "" || o.CertFile != "" || o.ServerName != ""
+}
+
+// newTransportCredentials builds the credentials shared by every grpc conn of the client.
+func newTransportCredentials(o tlsOptions) (credentials.TransportCredentials, error) {
+	if !o.enabled() {
+		return insecure.NewCredentials(), nil
+	}
+
+	var config *tls.Config
+	if o.Config != nil {
+		config = o.Config.Clone()
+	} else {
+		config = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if o.ServerName != "" {
+		config.ServerName = o.ServerName
+	}
+
+	if o.CertFile == "" && o.CAFile == "" {
+		return credentials.NewTLS(config), nil
+	}
+
+	reloader := &tlsFileReloader{
+		caFile:   o.CAFile,
+		certFile: o.CertFile,
+		keyFile:  o.KeyFile,
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	if o.CertFile != "" {
+		config.GetClientCertificate = reloader.clientCertificate
+	}
+	return &reloadingCredentials{
+		TransportCredentials: credentials.NewTLS(config),
+		config:               config,
+		reloader:             reloader,
+	}, nil
+}
+
+// reloadingCredentials sets the reloaded CA pool as RootCAs for every handshake, the server certificate
+// is verified as usual against the configured server name, or the host of the dialed address.
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+	config   *tls.Config
+	reloader *tlsFileReloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string,
+	rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	config := c.config.Clone()
+	if c.reloader.caFile != "" {
+		config.RootCAs, _ = c.reloader.current()
+	}
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		config:               c.config.Clone(),
+		reloader:             c.reloader,
+	}
+}
+
+// tlsFileReloader reloads the CA bundle and the client certificate when the files change on disk,
+// the files are checked on every handshake.
+type tlsFileReloader struct {
+	caFile   string
+	certFile string
+	keyFile  string
+
+	mutex   sync.Mutex
+	modTime time.Time
+	caPool  *x509.CertPool
+	cert    *tls.Certificate
+}
+
+func (r *tlsFileReloader) reload() error {
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read tls ca file, err:%w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in tls ca file, file:%s", r.caFile)
+		}
+		r.caPool = pool
+	}
+
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("load tls client certificate, err:%w", err)
+		}
+		r.cert = &cert
+	}
+
+	r.modTime = r.latestModTime()
+	return nil
+}
+
+func (r *tlsFileReloader) latestModTime() time.Time {
+	latest := time.Time{}
+	for _, file := range []string{r.caFile, r.certFile, r.keyFile} {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// current returns the loaded files, a failed reload keeps the previous ones.
+func (r *tlsFileReloader) current() (*x509.CertPool, *tls.Certificate) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.latestModTime().After(r.modTime) {
+		_ = r.reload()
+	}
+	return r.caPool, r.cert
+}
+
+func (r *tlsFileReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	_, cert := r.current()
+	return cert, nil
+}
@@ -19,8 +19,15 @@
 
 package horaedb
 
+import (
+	"strings"
+	"sync"
+)
+
 type RequestContext struct {
 	Database string
+	// Metadata is sent as gRPC metadata with the RPCs of this request.
+	Metadata map[string]string
 }
 
 type WriteRequest struct {
@@ -32,10 +39,47 @@ type WriteResponse struct {
 	Success uint32
 	Failed  uint32
 	Message string
+	// Failures lists the batches that were not written, one per endpoint.
+	// Points failed by the server inside an accepted batch are only counted in Failed.
+	Failures []WriteFailure
+}
+
+// WriteFailure describes a batch of points which failed to be written to an endpoint.
+type WriteFailure struct {
+	// Endpoint is empty if the points failed before they were routed.
+	Endpoint string
+	Tables   []string
+	// Code is the HoraeDB code when Err is an *Error, otherwise zero.
+	Code uint32
+	Err  error
+	// Points is nil for the failures of a StreamWriter, which doesn't keep the sent points.
+	Points []Point
+}
+
+// FailedPoints returns all the points listed in Failures.
+func (r WriteResponse) FailedPoints() []Point {
+	var points []Point
+	for _, failure := range r.Failures {
+		points = append(points, failure.Points...)
+	}
+	return points
+}
+
+// FailedRequest rebuilds a WriteRequest with only the failed points, ok is false if there are none.
+func (r WriteResponse) FailedRequest(reqCtx RequestContext) (req WriteRequest, ok bool) {
+	points := r.FailedPoints()
+	if len(points) == 0 {
+		return WriteRequest{}, false
+	}
+	return WriteRequest{
+		ReqCtx: reqCtx,
+		Points: points,
+	}, true
 }
 
 type SQLQueryRequest struct {
 	ReqCtx RequestContext
+	// Tables routes the query, it is extracted from SQL by ExtractTables if empty.
 	Tables []string
 	SQL    string
 }
@@ -44,6 +88,16 @@ type SQLQueryResponse struct {
 	SQL          string
 	AffectedRows uint32
 	Rows         []Row
+	// Schema describes the columns of Rows. It is empty when the server returns no record batch, which
+	// SQLQuery reports as ErrNullRows.
+	Schema []ColumnSchema
+}
+
+// ColumnSchema describes a column of a query result.
+type ColumnSchema struct {
+	Name     string
+	DataType DataType
+	Nullable bool
 }
 
 type Column struct {
@@ -60,10 +114,54 @@ func (c Column) Value() Value {
 }
 
 type Row struct {
-	fields []string
+	schema *rowSchema
 	values []Value
 }
 
+// rowSchema is shared by all the rows of a result with the same columns, and caches the column lookups.
+type rowSchema struct {
+	columns     []ColumnSchema
+	fields      []string
+	indexes     map[string]int
+	foldIndexes map[string]int // lower case name -> index, used to match untagged struct fields
+	plans       sync.Map       // reflect.Type -> *scanPlan
+}
+
+func newRowSchema(columns []ColumnSchema) *rowSchema {
+	fields := make([]string, len(columns))
+	indexes := make(map[string]int, len(columns))
+	foldIndexes := make(map[string]int, len(columns))
+	for idx, column := range columns {
+		field := column.Name
+		fields[idx] = field
+		if _, ok := indexes[field]; !ok {
+			indexes[field] = idx
+		}
+		if _, ok := foldIndexes[strings.ToLower(field)]; !ok {
+			foldIndexes[strings.ToLower(field)] = idx
+		}
+	}
+	return &rowSchema{
+		columns:     columns,
+		fields:      fields,
+		indexes:     indexes,
+		foldIndexes: foldIndexes,
+	}
+}
+
+// sameColumns reports whether the schema can be reused for the columns.
+func (s *rowSchema) sameColumns(columns []ColumnSchema) bool {
+	if s == nil || len(s.columns) != len(columns) {
+		return false
+	}
+	for idx, column := range columns {
+		if s.columns[idx] != column {
+			return false
+		}
+	}
+	return true
+}
+
 func (r Row) HasColumn(name string) bool {
 	_, ok := r.getColumnIdx(name)
 	return ok
@@ -78,17 +176,19 @@ func (r Row) Column(name string) (Column, bool) {
 
 func (r Row) Columns() []Column {
 	columns := make([]Column, 0, len(r.values))
-	for idx, field := range r.fields {
-		columns = append(columns, Column{field, r.values[idx]})
+	for idx, value := range r.values {
+		columns = append(columns, Column{r.schema.fields[idx], value})
 	}
 	return columns
 }
 
 func (r Row) getColumnIdx(name string) (int, bool) {
-	for idx, field := range r.fields {
-		if field == name {
-			return idx, true
-		}
+	if r.schema == nil {
+		return -1, false
+	}
+	idx, ok := r.schema.indexes[name]
+	if !ok {
+		return -1, false
 	}
-	return -1, false
+	return idx, true
 }
@@ -20,6 +20,7 @@
 package horaedb
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -55,5 +56,99 @@ func splitPointsByRoute(points []Point, routes map[string]route) (map[string][]P
 func combineWriteResponse(r1 WriteResponse, r2 WriteResponse) WriteResponse {
 	r1.Success += r2.Success
 	r1.Failed += r2.Failed
+	// Only return first error message now.
+	if r1.Message == "" {
+		r1.Message = r2.Message
+	}
+	if len(r2.Failures) > 0 {
+		r1.Failures = append(r1.Failures, r2.Failures...)
+	}
 	return r1
 }
+
+func failedWriteResponse(endpoint string, points []Point, err error) WriteResponse {
+	return WriteResponse{
+		Failed:  uint32(len(points)),
+		Message: err.Error(),
+		Failures: []WriteFailure{{
+			Endpoint: endpoint,
+			Tables:   getTablesFromPoints(points),
+			Code:     errorCode(err),
+			Err:      err,
+			Points:   points,
+		}},
+	}
+}
+
+// splitPointsBySize splits the points into chunks of at most maxPoints points and maxBytes estimated bytes,
+// zero means no limit. A point larger than maxBytes gets a chunk of its own.
+func splitPointsBySize(points []Point, maxPoints, maxBytes int) [][]Point {
+	if (maxPoints <= 0 || len(points) <= maxPoints) && maxBytes <= 0 {
+		return [][]Point{points}
+	}
+
+	var chunks [][]Point
+	start, size := 0, 0
+	for idx, point := range points {
+		pSize := pointSize(point)
+		full := maxPoints > 0 && idx-start >= maxPoints
+		tooLarge := maxBytes > 0 && size+pSize > maxBytes
+		if idx > start && (full || tooLarge) {
+			chunks = append(chunks, points[start:idx])
+			start, size = idx, 0
+		}
+		size += pSize
+	}
+	return append(chunks, points[start:])
+}
+
+// errorCode returns the HoraeDB code carried by err, or zero if err is not an *Error.
+func errorCode(err error) uint32 {
+	var horaeErr *Error
+	if errors.As(err, &horaeErr) {
+		return horaeErr.Code
+	}
+	return 0
+}
+
+// pointSize estimates the encoded size of the point in bytes.
+func pointSize(point Point) int {
+	size := len(point.Table) + 8
+	for name, value := range point.Tags {
+		size += len(name) + valueSize(value)
+	}
+	for name, value := range point.Fields {
+		size += len(name) + valueSize(value)
+	}
+	return size
+}
+
+func valueSize(v Value) int {
+	if v.IsNull() {
+		return 0
+	}
+
+	switch v.DataType() {
+	case STRING:
+		return len(v.StringValue())
+	case VARBINARY:
+		return len(v.VarbinaryValue())
+	case BOOL, INT8, UINT8:
+		return 1
+	case INT16, UINT16:
+		return 2
+	case FLOAT, INT32, UINT32:
+		return 4
+	default:
+		return 8
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -19,6 +19,10 @@
 
 package horaedb
 
+import (
+	"fmt"
+)
+
 type DataType int
 
 const (
@@ -39,6 +43,31 @@ const (
 	VARBINARY
 )
 
+var dataTypeNames = map[DataType]string{
+	NULL:      "NULL",
+	TIMESTAMP: "TIMESTAMP",
+	STRING:    "STRING",
+	DOUBLE:    "DOUBLE",
+	FLOAT:     "FLOAT",
+	INT64:     "INT64",
+	INT32:     "INT32",
+	INT16:     "INT16",
+	INT8:      "INT8",
+	UINT64:    "UINT64",
+	UINT32:    "UINT32",
+	UINT16:    "UINT16",
+	UINT8:     "UINT8",
+	BOOL:      "BOOL",
+	VARBINARY: "VARBINARY",
+}
+
+func (t DataType) String() string {
+	if name, ok := dataTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("DataType(%d)", int(t))
+}
+
 type Value struct {
 	dataType  DataType
 	dataValue interface{}
@@ -151,6 +180,20 @@ func (v Value) VarbinaryValue() []byte {
 	return v.dataValue.([]byte)
 }
 
+// NewTimestampValue creates a timestamp in milliseconds.
+func NewTimestampValue(v int64) Value {
+	return Value{
+		dataType:  TIMESTAMP,
+		dataValue: v,
+	}
+}
+
+func NewTimestampNullValue() Value {
+	return Value{
+		dataType: TIMESTAMP,
+	}
+}
+
 func NewStringValue(v string) Value {
 	return Value{
 		dataType:  STRING,
@@ -0,0 +1,71 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestBearerTokenAndMetadata(t *testing.T) {
+	var tokens int32
+	source := horaedb.TokenSourceFunc(func(context.Context) (horaedb.Token, error) {
+		atomic.AddInt32(&tokens, 1)
+		// Expires inside the refresh window, so every RPC fetches a new token.
+		return horaedb.Token{Value: "secret", Expiry: time.Now().Add(time.Second)}, nil
+	})
+
+	seen := make(chan metadata.MD, 4)
+	seed := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			md, _ := metadata.FromIncomingContext(ctx)
+			seen <- md
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithPerRPCCredentials(horaedb.NewBearerTokenCredentials(source, false)),
+		horaedb.WithMetadata(map[string]string{"x-client": "go", "X-Tenant": "default"}),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Write(context.Background(), horaedb.WriteRequest{
+			ReqCtx: horaedb.RequestContext{Metadata: map[string]string{"x-tenant": "tenant-a"}},
+			Points: buildClusterPoints(t, 1),
+		})
+		require.NoError(t, err, "write points failed")
+
+		md := <-seen
+		require.Equal(t, []string{"Bearer secret"}, md.Get("authorization"))
+		require.Equal(t, []string{"go"}, md.Get("x-client"))
+		require.Equal(t, []string{"tenant-a"}, md.Get("x-tenant"), "request metadata should override the static one")
+	}
+	require.GreaterOrEqual(t, atomic.LoadInt32(&tokens), int32(2), "expiring token should be refreshed")
+}
@@ -0,0 +1,271 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchWriterFlushBySize(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	results := make(chan horaedb.BatchResult, 16)
+	writer := horaedb.NewBatchWriter(client,
+		horaedb.WithBatchMaxPoints(2),
+		horaedb.WithBatchFlushInterval(0),
+		horaedb.WithBatchResultChan(results),
+	)
+
+	points, err := buildTablePoints("batch_test", currentMS(), 5)
+	require.NoError(t, err, "build points failed")
+	for _, point := range points {
+		require.NoError(t, writer.Add(point))
+	}
+
+	// Two full batches are flushed without an explicit Flush.
+	for i := 0; i < 2; i++ {
+		select {
+		case result := <-results:
+			require.NoError(t, result.Err)
+			require.Equal(t, uint32(2), result.Response.Success)
+		case <-time.After(5 * time.Second):
+			t.Fatal("batch is not flushed by size")
+		}
+	}
+
+	require.NoError(t, writer.Close(context.Background()))
+	result := <-results
+	require.NoError(t, result.Err)
+	require.Equal(t, uint32(1), result.Response.Success, "close should drain the remaining point")
+
+	require.ErrorIs(t, writer.Add(points[0]), horaedb.ErrBatchWriterClosed)
+}
+
+func TestBatchWriterFlushByInterval(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	var mutex sync.Mutex
+	success := uint32(0)
+	writer := horaedb.NewBatchWriter(client,
+		horaedb.WithBatchFlushInterval(50*time.Millisecond),
+		horaedb.WithBatchCallback(func(result horaedb.BatchResult) {
+			mutex.Lock()
+			success += result.Response.Success
+			mutex.Unlock()
+		}),
+	)
+	defer func() {
+		require.NoError(t, writer.Close(context.Background()))
+	}()
+
+	points, err := buildTablePoints("batch_test", currentMS(), 3)
+	require.NoError(t, err, "build points failed")
+	for _, point := range points {
+		require.NoError(t, writer.Add(point))
+	}
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return success == 3
+	}, 5*time.Second, 10*time.Millisecond, "batch is not flushed by interval")
+}
+
+// blockingClient blocks every Write until its ctx is done.
+type blockingClient struct {
+	horaedb.Client
+
+	started chan struct{}
+	aborted chan error
+}
+
+func (c *blockingClient) Write(ctx context.Context, _ horaedb.WriteRequest) (horaedb.WriteResponse, error) {
+	select {
+	case c.started <- struct{}{}:
+	default:
+	}
+	<-ctx.Done()
+	c.aborted <- ctx.Err()
+	return horaedb.WriteResponse{}, ctx.Err()
+}
+
+func TestBatchWriterFlushAfterClose(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	writer := horaedb.NewBatchWriter(client, horaedb.WithBatchFlushInterval(0))
+	require.NoError(t, writer.Close(context.Background()))
+
+	errs := make(chan error, 100)
+	go func() {
+		for i := 0; i < cap(errs); i++ {
+			errs <- writer.Flush(context.Background())
+		}
+	}()
+	for i := 0; i < cap(errs); i++ {
+		select {
+		case err := <-errs:
+			require.ErrorIs(t, err, horaedb.ErrBatchWriterClosed)
+		case <-time.After(5 * time.Second):
+			t.Fatal("flush after close blocks")
+		}
+	}
+}
+
+func TestBatchWriterCloseStopsOnCancel(t *testing.T) {
+	client := &blockingClient{started: make(chan struct{}, 1), aborted: make(chan error, 4)}
+	writer := horaedb.NewBatchWriter(client, horaedb.WithBatchFlushInterval(10*time.Millisecond))
+
+	points, err := buildTablePoints("batch_test", currentMS(), 1)
+	require.NoError(t, err, "build points failed")
+	require.NoError(t, writer.Add(points[0]))
+	select {
+	case <-client.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch is not flushed by interval")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, writer.Close(ctx), context.DeadlineExceeded)
+
+	select {
+	case err := <-client.aborted:
+		require.ErrorIs(t, err, context.Canceled, "the background flush should be cancelled on stop")
+	case <-time.After(5 * time.Second):
+		t.Fatal("background flush is not cancelled")
+	}
+
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer closeCancel()
+	require.NoError(t, writer.Close(closeCtx), "the writer should be stopped")
+	require.ErrorIs(t, writer.Flush(context.Background()), horaedb.ErrBatchWriterClosed)
+}
+
+func TestBatchWriterGroupsByEndpoint(t *testing.T) {
+	other := &mockStorageServer{}
+	startMockServer(t, other)
+	srv := &mockStorageServer{}
+	srv.routeFn = func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		return routeResponseTo(req.Tables, func(table string) string {
+			if table == "batch_other" {
+				return other.addr
+			}
+			return srv.addr
+		}), nil
+	}
+	seed := startMockServer(t, srv)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	tables := []string{"batch_test1", "batch_test2", "batch_other"}
+	var points []horaedb.Point
+	for _, table := range tables {
+		tablePoints, err := buildTablePoints(table, currentMS(), 1)
+		require.NoError(t, err, "build points failed")
+		points = append(points, tablePoints...)
+	}
+	// Cache the routes of the tables.
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+	require.NoError(t, err, "write points failed")
+
+	results := make(chan horaedb.BatchResult, 16)
+	writer := horaedb.NewBatchWriter(client,
+		horaedb.WithBatchFlushInterval(0),
+		horaedb.WithBatchResultChan(results),
+	)
+	for _, point := range points {
+		require.NoError(t, writer.Add(point))
+	}
+	require.NoError(t, writer.Close(context.Background()))
+	close(results)
+
+	var batchTables [][]string
+	for result := range results {
+		require.NoError(t, result.Err)
+		var resultTables []string
+		for _, point := range result.Points {
+			resultTables = append(resultTables, point.Table)
+		}
+		batchTables = append(batchTables, resultTables)
+	}
+	require.Len(t, batchTables, 2, "points should be written once per endpoint")
+	require.ElementsMatch(t, [][]string{{"batch_other"}, {"batch_test1", "batch_test2"}}, sortedTables(batchTables))
+}
+
+func sortedTables(batchTables [][]string) [][]string {
+	for _, tables := range batchTables {
+		sort.Strings(tables)
+	}
+	return batchTables
+}
+
+func TestBatchWriterCloseReportsUnflushedPoints(t *testing.T) {
+	client := &blockingClient{started: make(chan struct{}, 1), aborted: make(chan error, 4)}
+
+	var mutex sync.Mutex
+	reported := make(map[error]int)
+	writer := horaedb.NewBatchWriter(client,
+		horaedb.WithBatchMaxPoints(1),
+		horaedb.WithBatchQueueSize(1),
+		horaedb.WithBatchFlushInterval(0),
+		horaedb.WithBatchCallback(func(result horaedb.BatchResult) {
+			mutex.Lock()
+			reported[result.Err] += len(result.Points)
+			mutex.Unlock()
+		}),
+	)
+
+	points, err := buildTablePoints("batch_test", currentMS(), 3)
+	require.NoError(t, err, "build points failed")
+	require.NoError(t, writer.Add(points[0]))
+	select {
+	case <-client.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("full batch is not flushed")
+	}
+	// The background writer is busy, one more batch is queued and the last point stays buffered.
+	require.NoError(t, writer.Add(points[1]))
+	require.NoError(t, writer.Add(points[2]))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, writer.Close(ctx), context.DeadlineExceeded)
+
+	require.Eventually(t, func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return reported[context.Canceled] == 2 && reported[horaedb.ErrBatchWriterClosed] == 1
+	}, 5*time.Second, 10*time.Millisecond, "every unflushed point should be reported")
+}
@@ -0,0 +1,161 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// restartableServer serves a mockStorageServer on a fixed address, so it can be stopped and started again.
+type restartableServer struct {
+	t      *testing.T
+	addr   string
+	server *grpc.Server
+}
+
+func (s *restartableServer) start() {
+	listener, err := net.Listen("tcp", s.addr)
+	require.NoError(s.t, err, "listen mock server failed")
+	s.addr = listener.Addr().String()
+
+	s.server = grpc.NewServer()
+	storagepb.RegisterStorageServiceServer(s.server, &mockStorageServer{addr: s.addr})
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+}
+
+func (s *restartableServer) stop() {
+	s.server.Stop()
+}
+
+func writeFailure(t *testing.T, client horaedb.Client) error {
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+	if len(resp.Failures) == 0 {
+		return nil
+	}
+	return resp.Failures[0].Err
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	server := &restartableServer{t: t, addr: "127.0.0.1:0"}
+	server.start()
+	defer server.stop()
+
+	client, err := horaedb.NewClient(server.addr, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithCircuitBreaker(2, 200*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	require.NoError(t, writeFailure(t, client))
+
+	server.stop()
+	for i := 0; i < 2; i++ {
+		err := writeFailure(t, client)
+		require.Error(t, err, "write to stopped server should fail")
+		require.False(t, errors.Is(err, horaedb.ErrCircuitOpen))
+	}
+
+	begin := time.Now()
+	err = writeFailure(t, client)
+	require.ErrorIs(t, err, horaedb.ErrCircuitOpen, "breaker should be open after consecutive failures")
+	var openErr *horaedb.CircuitOpenError
+	require.True(t, errors.As(err, &openErr))
+	require.Equal(t, server.addr, openErr.Endpoint)
+	require.Less(t, time.Since(begin), 50*time.Millisecond, "open breaker should fail fast")
+
+	server.start()
+	require.Eventually(t, func() bool {
+		return writeFailure(t, client) == nil
+	}, 3*time.Second, 50*time.Millisecond, "breaker should close after a healthy probe")
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	client, err := horaedb.NewClient(unreachableEndpoint(t), horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithCircuitBreaker(0, 0),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	for i := 0; i < 10; i++ {
+		err := writeFailure(t, client)
+		require.Error(t, err, "write to unreachable endpoint should fail")
+		require.False(t, errors.Is(err, horaedb.ErrCircuitOpen))
+	}
+}
+
+func TestCircuitBreakerIgnoresCallerDeadline(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, _ *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	client, err := horaedb.NewClient(seed, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithWriteTimeout(50*time.Millisecond),
+		horaedb.WithCircuitBreaker(2, time.Minute),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	write := func(ctx context.Context) error {
+		resp, err := client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+		if err != nil {
+			return err
+		}
+		if len(resp.Failures) > 0 {
+			return resp.Failures[0].Err
+		}
+		return nil
+	}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := write(ctx)
+		cancel()
+		require.Error(t, err, "hanging write should fail")
+		require.False(t, errors.Is(err, horaedb.ErrCircuitOpen), "deadline of the caller should not trip the breaker")
+	}
+
+	for i := 0; i < 2; i++ {
+		require.ErrorIs(t, write(context.Background()), horaedb.ErrTimeout)
+	}
+	require.ErrorIs(t, write(context.Background()), horaedb.ErrCircuitOpen, "write timeouts should trip the breaker")
+}
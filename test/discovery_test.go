@@ -0,0 +1,150 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileDiscoverer(t *testing.T) {
+	dir := t.TempDir()
+	cases := []struct {
+		name    string
+		content string
+	}{
+		{name: "list.json", content: `["10.0.0.1:8831", "10.0.0.2:8831"]`},
+		{name: "object.json", content: `{"endpoints": ["10.0.0.1:8831", "10.0.0.2:8831"]}`},
+		{name: "list.yaml", content: "- 10.0.0.1:8831\n- 10.0.0.2:8831\n"},
+		{name: "object.yml", content: "endpoints:\n  - 10.0.0.1:8831\n  - 10.0.0.2:8831\n"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(dir, c.name)
+			require.NoError(t, os.WriteFile(path, []byte(c.content), 0o600))
+
+			endpoints, err := horaedb.NewFileDiscoverer(path).Discover(context.Background())
+			require.NoError(t, err, "discover endpoints failed")
+			require.Equal(t, []string{"10.0.0.1:8831", "10.0.0.2:8831"}, endpoints)
+		})
+	}
+
+	path := filepath.Join(dir, "endpoints.toml")
+	require.NoError(t, os.WriteFile(path, []byte(""), 0o600))
+	_, err := horaedb.NewFileDiscoverer(path).Discover(context.Background())
+	require.Error(t, err, "unknown file type should fail")
+}
+
+func TestFileDiscovererReloadsModifiedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	require.NoError(t, os.WriteFile(path, []byte(`["10.0.0.1:8831"]`), 0o600))
+
+	discoverer := horaedb.NewFileDiscoverer(path)
+	endpoints, err := discoverer.Discover(context.Background())
+	require.NoError(t, err, "discover endpoints failed")
+	require.Equal(t, []string{"10.0.0.1:8831"}, endpoints)
+
+	require.NoError(t, os.WriteFile(path, []byte(`["10.0.0.2:8831"]`), 0o600))
+	modTime := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	endpoints, err = discoverer.Discover(context.Background())
+	require.NoError(t, err, "discover endpoints failed")
+	require.Equal(t, []string{"10.0.0.2:8831"}, endpoints)
+}
+
+func TestDNSDiscoverer(t *testing.T) {
+	endpoints, err := horaedb.NewDNSDiscoverer("localhost", 8831).Discover(context.Background())
+	require.NoError(t, err, "discover endpoints failed")
+	require.Contains(t, endpoints, net.JoinHostPort("127.0.0.1", "8831"))
+}
+
+func TestProxyFollowsDiscoveredEndpoints(t *testing.T) {
+	var writesA, writesB int32
+	proxyA := countingWriteServer(t, &writesA)
+	proxyB := countingWriteServer(t, &writesB)
+
+	var current atomic.Value
+	current.Store(proxyA)
+	discoverer := horaedb.DiscovererFunc(func(context.Context) ([]string, error) {
+		return []string{current.Load().(string)}, nil
+	})
+
+	client, err := horaedb.NewClientWithEndpoints(nil, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithDiscoverer(discoverer),
+		horaedb.WithDiscoveryInterval(20*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, int32(1), atomic.LoadInt32(&writesA))
+
+	current.Store(proxyB)
+	points := buildClusterPoints(t, 1)
+	require.Eventually(t, func() bool {
+		_, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+		return err == nil && atomic.LoadInt32(&writesB) > 0
+	}, time.Second, 30*time.Millisecond, "writes should move to the discovered proxy")
+}
+
+func TestDiscoveryFailureWithoutEndpoints(t *testing.T) {
+	discoverer := horaedb.DiscovererFunc(func(context.Context) ([]string, error) {
+		return nil, context.DeadlineExceeded
+	})
+	_, err := horaedb.NewClientWithEndpoints(nil, horaedb.Direct, horaedb.WithDiscoverer(discoverer))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDiscoveryWithoutInterval(t *testing.T) {
+	var writes, discoveries int32
+	proxy := countingWriteServer(t, &writes)
+	discoverer := horaedb.DiscovererFunc(func(context.Context) ([]string, error) {
+		atomic.AddInt32(&discoveries, 1)
+		return []string{proxy}, nil
+	})
+
+	client, err := horaedb.NewClientWithEndpoints(nil, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithDiscoverer(discoverer),
+		horaedb.WithDiscoveryInterval(0),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, int32(1), atomic.LoadInt32(&writes))
+	require.Equal(t, int32(1), atomic.LoadInt32(&discoveries), "zero interval should only discover at start")
+}
@@ -0,0 +1,162 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/stretchr/testify/require"
+)
+
+type upperString string
+
+func (s upperString) MarshalHoraeDB() (horaedb.Value, error) {
+	return horaedb.NewStringValue(strings.ToUpper(string(s))), nil
+}
+
+type encodeMetric struct {
+	Host     string        `horaedb:"host,tag"`
+	Region   upperString   `horaedb:"region,tag"`
+	Zone     *string       `horaedb:"zone,tag"`
+	Time     time.Time     `horaedb:",timestamp"`
+	Double   float64       `horaedb:"double,field"`
+	Float    float32       `horaedb:"float,field"`
+	Int64    int64         `horaedb:"int64,field"`
+	Int32    int32         `horaedb:"int32,field"`
+	Int16    int16         `horaedb:"int16,field"`
+	Int8     int8          `horaedb:"int8,field"`
+	Uint64   uint64        `horaedb:"uint64,field"`
+	Uint32   uint32        `horaedb:"uint32,field"`
+	Uint16   uint16        `horaedb:"uint16,field"`
+	Uint8    uint8         `horaedb:"uint8,field"`
+	Bool     bool          `horaedb:"bool,field"`
+	Binary   []byte        `horaedb:"binary,field"`
+	Seen     time.Time     `horaedb:"seen,field"`
+	Optional *int64        `horaedb:"optional,field"`
+	Raw      horaedb.Value `horaedb:"raw"`
+	Ignored  string
+	Skipped  string `horaedb:"-"`
+}
+
+func TestMarshalPoints(t *testing.T) {
+	ts := time.UnixMilli(1700000000000)
+	optional := int64(7)
+	metrics := []encodeMetric{
+		{
+			Host: "host-a", Region: "east", Time: ts,
+			Double: 0.64, Float: 0.32, Int64: -64, Int32: -32, Int16: -16, Int8: -8,
+			Uint64: 64, Uint32: 32, Uint16: 16, Uint8: 8, Bool: true, Binary: []byte{1, 2},
+			Seen: ts, Optional: &optional, Raw: horaedb.NewStringValue("raw"), Ignored: "ignored",
+		},
+		{Host: "host-b", Region: "west", Time: ts.Add(time.Second), Raw: horaedb.NewDoubleValue(1)},
+	}
+
+	points, err := horaedb.MarshalPoints("encode_test", metrics)
+	require.NoError(t, err, "marshal points failed")
+	require.Len(t, points, 2)
+
+	expected, err := horaedb.NewPointBuilder("encode_test").
+		SetTimestamp(1700000000000).
+		AddTag("host", horaedb.NewStringValue("host-a")).
+		AddTag("region", horaedb.NewStringValue("EAST")).
+		AddTag("zone", horaedb.NewStringNullValue()).
+		AddField("double", horaedb.NewDoubleValue(0.64)).
+		AddField("float", horaedb.NewFloatValue(0.32)).
+		AddField("int64", horaedb.NewInt64Value(-64)).
+		AddField("int32", horaedb.NewInt32Value(-32)).
+		AddField("int16", horaedb.NewInt16Value(-16)).
+		AddField("int8", horaedb.NewInt8Value(-8)).
+		AddField("uint64", horaedb.NewUint64Value(64)).
+		AddField("uint32", horaedb.NewUint32Value(32)).
+		AddField("uint16", horaedb.NewUint16Value(16)).
+		AddField("uint8", horaedb.NewUint8Value(8)).
+		AddField("bool", horaedb.NewBoolValue(true)).
+		AddField("binary", horaedb.NewVarbinaryValue([]byte{1, 2})).
+		AddField("seen", horaedb.NewTimestampValue(1700000000000)).
+		AddField("optional", horaedb.NewInt64Value(7)).
+		AddField("raw", horaedb.NewStringValue("raw")).
+		Build()
+	require.NoError(t, err, "build point failed")
+	require.Equal(t, expected, points[0])
+
+	require.Equal(t, int64(1700000001000), points[1].Timestamp)
+	require.Equal(t, horaedb.NewInt64NullValue(), points[1].Fields["optional"])
+	require.Equal(t, horaedb.NewTimestampNullValue(), points[1].Fields["seen"], "zero time should be null")
+
+	point, err := horaedb.NewPointEncoder("encode_test").Encode(&metrics[0])
+	require.NoError(t, err, "encode pointer failed")
+	require.Equal(t, expected, point)
+}
+
+func TestMarshalPointsWrite(t *testing.T) {
+	endpoint := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	points, err := horaedb.MarshalPoints("encode_test", []*encodeMetric{
+		{Host: "host-a", Region: "east", Time: time.Now(), Seen: time.Now()},
+		{Host: "host-b", Region: "west", Time: time.Now()},
+	})
+	require.NoError(t, err, "marshal points failed")
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(2), resp.Success)
+}
+
+func TestMarshalPointsErrors(t *testing.T) {
+	type noTimestamp struct {
+		Host  string  `horaedb:"host,tag"`
+		Value float64 `horaedb:"value,field"`
+	}
+	_, err := horaedb.MarshalPoints("t", []noTimestamp{{Host: "a", Value: 1}})
+	require.ErrorIs(t, err, horaedb.ErrMarshalType)
+
+	type intTag struct {
+		Host  int     `horaedb:"host,tag"`
+		Value float64 `horaedb:"value,field"`
+		Time  int64   `horaedb:",timestamp"`
+	}
+	_, err = horaedb.MarshalPoints("t", []intTag{{Host: 1, Value: 1, Time: 1}})
+	require.ErrorIs(t, err, horaedb.ErrMarshalType)
+
+	type unsupported struct {
+		Value map[string]int `horaedb:"value,field"`
+		Time  int64          `horaedb:",timestamp"`
+	}
+	_, err = horaedb.MarshalPoints("t", []unsupported{{Time: 1}})
+	require.ErrorIs(t, err, horaedb.ErrMarshalType)
+
+	type noFields struct {
+		Host string `horaedb:"host,tag"`
+		Time int64  `horaedb:",timestamp"`
+	}
+	_, err = horaedb.MarshalPoints("t", []noFields{{Host: "a", Time: 1}})
+	require.ErrorIs(t, err, horaedb.ErrPointEmptyFields)
+
+	_, err = horaedb.MarshalPoints("t", noFields{})
+	require.ErrorIs(t, err, horaedb.ErrMarshalType)
+}
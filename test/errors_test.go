@@ -0,0 +1,130 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errorClasses = []error{
+	horaedb.ErrUnavailable,
+	horaedb.ErrTimeout,
+	horaedb.ErrFlowControl,
+	horaedb.ErrInvalidRoute,
+	horaedb.ErrServerInternal,
+	horaedb.ErrClientValidation,
+	horaedb.ErrUnauthorized,
+}
+
+func requireErrorClass(t *testing.T, err error, class error) {
+	require.Error(t, err)
+	for _, c := range errorClasses {
+		require.Equal(t, c == class, errors.Is(err, c), "err:%v, class:%v", err, c)
+	}
+}
+
+func TestQueryErrorClassification(t *testing.T) {
+	cases := []struct {
+		name  string
+		err   error
+		code  uint32
+		class error
+	}{
+		{name: "invalid route", code: 302, class: horaedb.ErrInvalidRoute},
+		{name: "flow control", code: 503, class: horaedb.ErrFlowControl},
+		{name: "server internal", code: 500, class: horaedb.ErrServerInternal},
+		{name: "bad request", code: 400, class: horaedb.ErrClientValidation},
+		{name: "grpc unavailable", err: status.Error(codes.Unavailable, "shutting down"), class: horaedb.ErrUnavailable},
+		{name: "grpc deadline", err: status.Error(codes.DeadlineExceeded, "too slow"), class: horaedb.ErrTimeout},
+		{name: "grpc exhausted", err: status.Error(codes.ResourceExhausted, "busy"), class: horaedb.ErrFlowControl},
+		{name: "grpc invalid argument", err: status.Error(codes.InvalidArgument, "bad sql"), class: horaedb.ErrClientValidation},
+		{name: "grpc unauthenticated", err: status.Error(codes.Unauthenticated, "no token"), class: horaedb.ErrUnauthorized},
+		{name: "grpc permission denied", err: status.Error(codes.PermissionDenied, "read only"), class: horaedb.ErrUnauthorized},
+		{name: "grpc internal", err: status.Error(codes.Internal, "panic"), class: horaedb.ErrServerInternal},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			endpoint := startMockServer(t, &mockStorageServer{
+				sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+					if c.err != nil {
+						return nil, c.err
+					}
+					return &storagepb.SqlQueryResponse{Header: &commonpb.ResponseHeader{Code: c.code, Error: c.name}}, nil
+				},
+			})
+			client, err := horaedb.NewClient(endpoint, horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+			require.NoError(t, err, "init horaedb client failed")
+			defer func() {
+				_ = client.Close(context.Background())
+			}()
+
+			_, err = client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{Tables: []string{"t"}, SQL: "select 1"})
+			requireErrorClass(t, err, c.class)
+
+			if c.err != nil {
+				var grpcErr *horaedb.GRPCError
+				require.True(t, errors.As(err, &grpcErr))
+				require.Equal(t, status.Code(c.err), grpcErr.Code)
+			} else {
+				var horaeErr *horaedb.Error
+				require.True(t, errors.As(err, &horaeErr))
+				require.Equal(t, c.code, horaeErr.Code)
+			}
+		})
+	}
+}
+
+func TestUnreachableEndpointIsUnavailable(t *testing.T) {
+	client, err := horaedb.NewClient(unreachableEndpoint(t), horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	_, err = client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{Tables: []string{"t"}, SQL: "select 1"})
+	requireErrorClass(t, err, horaedb.ErrUnavailable)
+}
+
+func TestValidationErrors(t *testing.T) {
+	client, err := horaedb.NewClient(unreachableEndpoint(t), horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	// Null rows is not a validation error, it matches none of the classes.
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{})
+	requireErrorClass(t, err, nil)
+	require.ErrorIs(t, err, horaedb.ErrNullRows)
+
+	_, err = horaedb.NewPointBuilder("t").SetTimestamp(currentMS()).AddTag("k", horaedb.NewStringValue("v")).Build()
+	requireErrorClass(t, err, horaedb.ErrClientValidation)
+	require.ErrorIs(t, err, horaedb.ErrPointEmptyFields)
+}
@@ -0,0 +1,204 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// mockStorageServer is an in-process StorageService, every handler left nil falls back to a successful default.
+type mockStorageServer struct {
+	storagepb.UnimplementedStorageServiceServer
+
+	addr string
+
+	routeFn    func(context.Context, *storagepb.RouteRequest) (*storagepb.RouteResponse, error)
+	writeFn    func(context.Context, *storagepb.WriteRequest) (*storagepb.WriteResponse, error)
+	sqlQueryFn func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error)
+
+	streamQueryResponses []*storagepb.SqlQueryResponse
+	// streamWriteClosed is called with the rows of every write stream closed by the client.
+	streamWriteClosed func(rows uint32)
+}
+
+// nolint
+func startMockServer(t *testing.T, srv *mockStorageServer, opts ...grpc.ServerOption) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "listen mock server failed")
+
+	grpcServer := grpc.NewServer(opts...)
+	storagepb.RegisterStorageServiceServer(grpcServer, srv)
+	go func() {
+		_ = grpcServer.Serve(listener)
+	}()
+	t.Cleanup(grpcServer.Stop)
+
+	srv.addr = listener.Addr().String()
+	return srv.addr
+}
+
+// nolint
+func unreachableEndpoint(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "listen failed")
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close(), "close listener failed")
+	return addr
+}
+
+func (s *mockStorageServer) Route(ctx context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+	if s.routeFn != nil {
+		return s.routeFn(ctx, req)
+	}
+	return routeResponseTo(req.Tables, func(string) string { return s.addr }), nil
+}
+
+func (s *mockStorageServer) Write(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+	if s.writeFn != nil {
+		return s.writeFn(ctx, req)
+	}
+	return &storagepb.WriteResponse{
+		Header:  &commonpb.ResponseHeader{Code: 200},
+		Success: countWriteRows(req),
+	}, nil
+}
+
+func (s *mockStorageServer) StreamWrite(stream storagepb.StorageService_StreamWriteServer) error {
+	rows := uint32(0)
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if s.streamWriteClosed != nil {
+				s.streamWriteClosed(rows)
+			}
+			return stream.SendAndClose(&storagepb.WriteResponse{
+				Header:  &commonpb.ResponseHeader{Code: 200},
+				Success: rows,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		rows += countWriteRows(req)
+	}
+}
+
+func (s *mockStorageServer) SqlQuery(ctx context.Context, req *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+	if s.sqlQueryFn != nil {
+		return s.sqlQueryFn(ctx, req)
+	}
+	return &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_AffectedRows{AffectedRows: 0},
+	}, nil
+}
+
+func (s *mockStorageServer) StreamSqlQuery(_ *storagepb.SqlQueryRequest, stream storagepb.StorageService_StreamSqlQueryServer) error {
+	for _, resp := range s.streamQueryResponses {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nolint
+func routeResponseTo(tables []string, endpointOf func(table string) string) *storagepb.RouteResponse {
+	resp := &storagepb.RouteResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Routes: make([]*storagepb.Route, 0, len(tables)),
+	}
+	for _, table := range tables {
+		host, port, _ := net.SplitHostPort(endpointOf(table))
+		portNum, _ := strconv.Atoi(port)
+		resp.Routes = append(resp.Routes, &storagepb.Route{
+			Table:    table,
+			Endpoint: &storagepb.Endpoint{Ip: host, Port: uint32(portNum)},
+		})
+	}
+	return resp
+}
+
+// nolint
+func countWriteRows(req *storagepb.WriteRequest) uint32 {
+	rows := uint32(0)
+	for _, tableReq := range req.TableRequests {
+		for _, entry := range tableReq.Entries {
+			rows += uint32(len(entry.FieldGroups))
+		}
+	}
+	return rows
+}
+
+// mockQueryRow is one row of the mock query result, with a timestamp, a string tag and a double field.
+type mockQueryRow struct {
+	timestamp int64
+	name      string
+	value     float64
+}
+
+// nolint
+func arrowQueryResponse(t *testing.T, batches ...[]mockQueryRow) *storagepb.SqlQueryResponse {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "timestamp", Type: arrow.FixedWidthTypes.Timestamp_ms},
+		{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	}, nil)
+
+	payload := &storagepb.ArrowPayload{}
+	for _, rows := range batches {
+		builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+		for _, row := range rows {
+			builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(row.timestamp))
+			builder.Field(1).(*array.StringBuilder).Append(row.name)
+			builder.Field(2).(*array.Float64Builder).Append(row.value)
+		}
+		record := builder.NewRecord()
+
+		var buf bytes.Buffer
+		writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+		require.NoError(t, writer.Write(record), "write arrow record failed")
+		require.NoError(t, writer.Close(), "close arrow writer failed")
+		record.Release()
+		builder.Release()
+
+		payload.RecordBatches = append(payload.RecordBatches, buf.Bytes())
+	}
+
+	return &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_Arrow{Arrow: payload},
+	}
+}
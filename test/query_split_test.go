@@ -0,0 +1,198 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+// splitCluster has two nodes, table a routes to nodeA and table b to nodeB, and records the queries of every node.
+type splitCluster struct {
+	nodeA, nodeB string
+
+	mutex   sync.Mutex
+	queries map[string][]string // node -> sql
+}
+
+func startSplitCluster(t *testing.T) *splitCluster {
+	c := &splitCluster{queries: make(map[string][]string)}
+	routeFn := func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		return routeResponseTo(req.Tables, func(table string) string {
+			if table == "b" {
+				return c.nodeB
+			}
+			return c.nodeA
+		}), nil
+	}
+	c.nodeA = c.startNode(t, routeFn, []mockQueryRow{{1, "a", 0.1}, {2, "a", 0.2}})
+	c.nodeB = c.startNode(t, routeFn, []mockQueryRow{{3, "b", 0.3}})
+	return c
+}
+
+func (c *splitCluster) startNode(t *testing.T, routeFn func(context.Context, *storagepb.RouteRequest) (*storagepb.RouteResponse, error), rows []mockQueryRow) string {
+	var addr string
+	addr = startMockServer(t, &mockStorageServer{
+		routeFn: routeFn,
+		sqlQueryFn: func(_ context.Context, req *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			c.mutex.Lock()
+			c.queries[addr] = append(c.queries[addr], req.Sql)
+			c.mutex.Unlock()
+			return arrowQueryResponse(t, rows), nil
+		},
+	})
+	return addr
+}
+
+func (c *splitCluster) queriesOf(node string) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.queries[node]
+}
+
+func TestQuerySplitRoutesConflict(t *testing.T) {
+	cluster := startSplitCluster(t)
+	client, err := horaedb.NewClient(cluster.nodeA, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	for _, sql := range []string{
+		"SELECT * FROM a JOIN b ON a.timestamp = b.timestamp",
+		"SELECT * FROM a UNION SELECT * FROM b",
+		"SELECT * FROM a UNION ALL SELECT * FROM b ORDER BY timestamp",
+		"SELECT * FROM a UNION ALL SELECT * FROM a JOIN b ON a.timestamp = b.timestamp",
+	} {
+		_, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: sql})
+		require.ErrorIs(t, err, horaedb.ErrRouteConflict, "sql:%s", sql)
+
+		var conflictErr *horaedb.RouteConflictError
+		require.True(t, errors.As(err, &conflictErr), "sql:%s", sql)
+		require.Equal(t, map[string][]string{cluster.nodeA: {"a"}, cluster.nodeB: {"b"}}, conflictErr.Routes)
+		require.Contains(t, err.Error(), cluster.nodeB)
+	}
+	require.Empty(t, cluster.queriesOf(cluster.nodeA), "conflicting queries should not be sent")
+	require.Empty(t, cluster.queriesOf(cluster.nodeB), "conflicting queries should not be sent")
+
+	_, err = client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT * FROM a UNION ALL SELECT * FROM b"})
+	require.ErrorIs(t, err, horaedb.ErrRouteConflict, "split stream queries need a proxy")
+}
+
+func TestQuerySplitRoutesUnionAll(t *testing.T) {
+	cluster := startSplitCluster(t)
+	client, err := horaedb.NewClient(cluster.nodeA, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	sql := "SELECT * FROM a WHERE value > 0 UNION ALL SELECT * FROM `b` UNION ALL (SELECT * FROM a LIMIT 1);"
+	resp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: sql})
+	require.NoError(t, err, "union all of split routes failed")
+	require.Equal(t, sql, resp.SQL)
+	require.Len(t, resp.Rows, 3, "rows of both sub-queries should be merged")
+	require.Equal(t, []string{"timestamp", "name", "value"}, []string{resp.Schema[0].Name, resp.Schema[1].Name, resp.Schema[2].Name})
+
+	names := make(map[string]int)
+	for _, row := range resp.Rows {
+		name, ok := row.Column("name")
+		require.True(t, ok)
+		names[name.Value().StringValue()]++
+	}
+	require.Equal(t, map[string]int{"a": 2, "b": 1}, names)
+
+	require.Equal(t, []string{"SELECT * FROM a WHERE value > 0 UNION ALL (SELECT * FROM a LIMIT 1)"}, cluster.queriesOf(cluster.nodeA))
+	require.Equal(t, []string{"SELECT * FROM `b`"}, cluster.queriesOf(cluster.nodeB))
+}
+
+func TestQuerySplitRoutesByProxy(t *testing.T) {
+	cluster := startSplitCluster(t)
+	var proxied []string
+	var mutex sync.Mutex
+	proxy := startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(_ context.Context, req *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			mutex.Lock()
+			proxied = append(proxied, req.Sql)
+			mutex.Unlock()
+			return arrowQueryResponse(t, []mockQueryRow{{1, "joined", 1}}), nil
+		},
+		streamQueryResponses: []*storagepb.SqlQueryResponse{arrowQueryResponse(t, []mockQueryRow{{1, "joined", 1}})},
+	})
+	client, err := horaedb.NewClient(cluster.nodeA, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"), horaedb.WithQueryProxyEndpoints(proxy))
+	require.NoError(t, err, "init horaedb client failed")
+
+	join := "SELECT * FROM a JOIN b ON a.timestamp = b.timestamp"
+	resp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: join})
+	require.NoError(t, err, "query by proxy failed")
+	require.Len(t, resp.Rows, 1)
+
+	_, err = client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT * FROM a"})
+	require.NoError(t, err, "query of one node failed")
+
+	it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{SQL: join})
+	require.NoError(t, err, "stream query by proxy failed")
+	rows := 0
+	for it.Next() {
+		rows++
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+	require.Equal(t, 1, rows)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Equal(t, []string{join}, proxied, "only split queries should go to the proxy")
+	require.Equal(t, []string{"SELECT * FROM a"}, cluster.queriesOf(cluster.nodeA))
+	require.Empty(t, cluster.queriesOf(cluster.nodeB))
+}
+
+func TestQuerySplitRoutesEmptySubQuery(t *testing.T) {
+	var nodeA, nodeB string
+	routeFn := func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		return routeResponseTo(req.Tables, func(table string) string {
+			if table == "b" {
+				return nodeB
+			}
+			return nodeA
+		}), nil
+	}
+	nodeA = startMockServer(t, &mockStorageServer{
+		routeFn: routeFn,
+		sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			return arrowQueryResponse(t, []mockQueryRow{{1, "a", 0.1}}), nil
+		},
+	})
+	nodeB = startMockServer(t, &mockStorageServer{
+		routeFn: routeFn,
+		sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			// No record batch at all for an empty result.
+			return arrowQueryResponse(t), nil
+		},
+	})
+	client, err := horaedb.NewClient(nodeA, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT * FROM a UNION ALL SELECT * FROM b"})
+	require.NoError(t, err, "empty sub-query should not fail the union")
+	require.Len(t, resp.Rows, 1)
+	require.Len(t, resp.Schema, 3)
+}
@@ -0,0 +1,158 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryStream(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{
+		streamQueryResponses: []*storagepb.SqlQueryResponse{
+			arrowQueryResponse(t,
+				[]mockQueryRow{{1, "a", 0.1}, {2, "b", 0.2}},
+				[]mockQueryRow{{3, "c", 0.3}},
+			),
+			arrowQueryResponse(t, []mockQueryRow{{4, "d", 0.4}}),
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{
+		Tables: []string{"demo"},
+		SQL:    "SELECT * FROM demo",
+	})
+	require.NoError(t, err, "open query stream failed")
+	defer it.Close()
+
+	timestamps := make([]int64, 0, 4)
+	for it.Next() {
+		ts, ok := it.Row().Column("timestamp")
+		require.True(t, ok, "column timestamp not found")
+		timestamps = append(timestamps, ts.Value().TimestampValue())
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int64{1, 2, 3, 4}, timestamps)
+}
+
+func TestQueryStreamError(t *testing.T) {
+	seed := startMockServer(t, &mockStorageServer{
+		streamQueryResponses: []*storagepb.SqlQueryResponse{
+			arrowQueryResponse(t, []mockQueryRow{{1, "a", 0.1}}),
+			{Header: &commonpb.ResponseHeader{Code: 500, Error: "scan failed"}},
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{
+		Tables: []string{"demo"},
+		SQL:    "SELECT * FROM demo",
+	})
+	require.NoError(t, err, "open query stream failed")
+	defer it.Close()
+
+	rows := 0
+	for it.Next() {
+		rows++
+	}
+	require.Equal(t, 1, rows)
+	require.ErrorContains(t, it.Err(), "scan failed")
+	require.False(t, it.Next(), "iterator should stay stopped")
+}
+
+func TestQueryTablesExtractedFromSQL(t *testing.T) {
+	var queried []string
+	seed := startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(_ context.Context, req *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			queried = req.Tables
+			return arrowQueryResponse(t, []mockQueryRow{{1, "a", 0.1}}), nil
+		},
+		streamQueryResponses: []*storagepb.SqlQueryResponse{arrowQueryResponse(t, []mockQueryRow{{1, "a", 0.1}})},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{
+		SQL: "SELECT * FROM demo d JOIN `other` o ON d.t = o.t",
+	})
+	require.NoError(t, err, "query without tables failed")
+	require.Len(t, resp.Rows, 1)
+	require.Equal(t, []string{"demo", "other"}, queried)
+
+	it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT * FROM demo"})
+	require.NoError(t, err, "stream query without tables failed")
+	for it.Next() {
+	}
+	require.NoError(t, it.Err())
+	require.NoError(t, it.Close())
+
+	_, err = client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT 1"})
+	require.ErrorIs(t, err, horaedb.ErrNullRequestTables)
+}
+
+// zstdQueryResponse compresses every record batch of the response with zstd.
+func zstdQueryResponse(t *testing.T, resp *storagepb.SqlQueryResponse) *storagepb.SqlQueryResponse {
+	encoder, err := zstd.NewWriter(nil)
+	require.NoError(t, err, "create zstd encoder failed")
+	defer encoder.Close()
+
+	payload := resp.Output.(*storagepb.SqlQueryResponse_Arrow).Arrow
+	for idx, batch := range payload.RecordBatches {
+		payload.RecordBatches[idx] = encoder.EncodeAll(batch, nil)
+	}
+	payload.Compression = storagepb.ArrowPayload_ZSTD
+	return resp
+}
+
+func TestQueryStreamZstdBatches(t *testing.T) {
+	batches := make([][]mockQueryRow, 0, 20)
+	for i := 0; i < cap(batches); i++ {
+		batches = append(batches, []mockQueryRow{{int64(i), "a", 0.1}, {int64(i), "b", 0.2}})
+	}
+	seed := startMockServer(t, &mockStorageServer{
+		streamQueryResponses: []*storagepb.SqlQueryResponse{zstdQueryResponse(t, arrowQueryResponse(t, batches...))},
+	})
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	for i := 0; i < 3; i++ {
+		it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{SQL: "SELECT * FROM demo"})
+		require.NoError(t, err, "open query stream failed")
+		rows := 0
+		for it.Next() {
+			rows++
+		}
+		require.NoError(t, it.Err())
+		require.NoError(t, it.Close())
+		require.Equal(t, 2*len(batches), rows)
+	}
+}
@@ -0,0 +1,112 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTablePoints(t *testing.T, client horaedb.Client, table string, count int) horaedb.WriteResponse {
+	points, err := buildTablePoints(table, currentMS(), count)
+	require.NoError(t, err, "build points failed")
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+	require.NoError(t, err, "write points failed")
+	return resp
+}
+
+func TestWriteRateLimit(t *testing.T) {
+	endpoint := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithWriteRateLimit(horaedb.RateLimit{PointsPerSecond: 50}),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	begin := time.Now()
+	writeTablePoints(t, client, "rate_limit_test", 50)
+	require.Less(t, time.Since(begin), 200*time.Millisecond, "a burst of one second should not wait")
+
+	begin = time.Now()
+	writeTablePoints(t, client, "rate_limit_test", 25)
+	require.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond, "write over the burst should wait for tokens")
+}
+
+func TestTableWriteRateLimit(t *testing.T) {
+	endpoint := startMockServer(t, &mockStorageServer{})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithTableWriteRateLimit("slow_table", horaedb.RateLimit{PointsPerSecond: 20}),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	begin := time.Now()
+	for i := 0; i < 5; i++ {
+		writeTablePoints(t, client, "fast_table", 20)
+	}
+	require.Less(t, time.Since(begin), 200*time.Millisecond, "tables without limit should not wait")
+
+	writeTablePoints(t, client, "slow_table", 20)
+	begin = time.Now()
+	writeTablePoints(t, client, "slow_table", 10)
+	require.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond, "limited table should wait for tokens")
+}
+
+func TestWriteRateLimitBacksOffOnFlowControl(t *testing.T) {
+	var writes int32
+	endpoint := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			if atomic.AddInt32(&writes, 1) == 2 {
+				return &storagepb.WriteResponse{Header: &commonpb.ResponseHeader{Code: 503, Error: "too many writes"}}, nil
+			}
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithWriteRateLimit(horaedb.RateLimit{PointsPerSecond: 100}),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	writeTablePoints(t, client, "flow_control_test", 100)
+	resp := writeTablePoints(t, client, "flow_control_test", 10)
+	require.Equal(t, uint32(10), resp.Failed)
+
+	// 25 points take 250ms at the limit, but twice as long after the rate is halved.
+	begin := time.Now()
+	writeTablePoints(t, client, "flow_control_test", 25)
+	require.GreaterOrEqual(t, time.Since(begin), 400*time.Millisecond, "rate should be lowered after flow control")
+}
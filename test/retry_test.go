@@ -0,0 +1,142 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+func testRetryPolicy() horaedb.RetryPolicy {
+	policy := horaedb.DefaultRetryPolicy()
+	policy.InitialBackoff = 10 * time.Millisecond
+	return policy
+}
+
+func TestWriteRetryOnlyFailedBatches(t *testing.T) {
+	var healthyWrites, movedWrites, newWrites int32
+	healthy := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(&healthyWrites, 1)
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+	moved := startMockServer(t, &mockStorageServer{
+		writeFn: func(context.Context, *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(&movedWrites, 1)
+			return &storagepb.WriteResponse{Header: &commonpb.ResponseHeader{Code: 302, Error: "route moved"}}, nil
+		},
+	})
+	newNode := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(&newWrites, 1)
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+
+	var routeCalls int32
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			calls := atomic.AddInt32(&routeCalls, 1)
+			return routeResponseTo(req.Tables, func(table string) string {
+				if table == "table_0" {
+					return healthy
+				}
+				if calls == 1 {
+					return moved
+				}
+				return newNode
+			}), nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRetryPolicy(testRetryPolicy()),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 2)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(2), resp.Success)
+	require.Equal(t, uint32(0), resp.Failed)
+	require.Equal(t, int32(1), atomic.LoadInt32(&healthyWrites), "successful batch should not be resent")
+	require.Equal(t, int32(1), atomic.LoadInt32(&movedWrites))
+	require.Equal(t, int32(1), atomic.LoadInt32(&newWrites), "failed batch should be resent to the refreshed route")
+}
+
+func TestWriteRetryExhausted(t *testing.T) {
+	var writes int32
+	seed := startMockServer(t, &mockStorageServer{
+		writeFn: func(context.Context, *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(&writes, 1)
+			return &storagepb.WriteResponse{Header: &commonpb.ResponseHeader{Code: 503, Error: "flow control"}}, nil
+		},
+	})
+
+	policy := testRetryPolicy()
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRetryPolicy(policy),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(1), resp.Failed)
+	require.Contains(t, resp.Message, "flow control")
+	require.Equal(t, int32(policy.MaxAttempts), atomic.LoadInt32(&writes))
+}
+
+func TestSQLQueryRetry(t *testing.T) {
+	var queries int32
+	seed := startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			if atomic.AddInt32(&queries, 1) == 1 {
+				return &storagepb.SqlQueryResponse{Header: &commonpb.ResponseHeader{Code: 310, Error: "should retry"}}, nil
+			}
+			return &storagepb.SqlQueryResponse{
+				Header: &commonpb.ResponseHeader{Code: 200},
+				Output: &storagepb.SqlQueryResponse_AffectedRows{AffectedRows: 1},
+			}, nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRetryPolicy(testRetryPolicy()),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{
+		Tables: []string{"demo"},
+		SQL:    "DROP TABLE demo",
+	})
+	require.NoError(t, err, "query failed")
+	require.Equal(t, uint32(1), resp.AffectedRows)
+	require.Equal(t, int32(2), atomic.LoadInt32(&queries))
+}
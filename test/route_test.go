@@ -20,11 +20,19 @@
 package test
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
 )
 
 func TestRouteGc(t *testing.T) {
@@ -67,3 +75,416 @@ func TestRouteProxy(t *testing.T) {
 	timestamp := currentMS()
 	testBaseWrite(t, client, "horaedb_route_test1", timestamp, 1)
 }
+
+// nolint
+func startHangingRouteServer(t *testing.T) string {
+	return startMockServer(t, &mockStorageServer{
+		routeFn: func(ctx context.Context, _ *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+}
+
+func TestRouteHonorsCallerDeadline(t *testing.T) {
+	seed := startHangingRouteServer(t)
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTimeout(time.Minute),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.Error(t, err, "hanging route should fail")
+	require.Less(t, time.Since(begin), 5*time.Second, "route should stop at the caller deadline")
+}
+
+func TestRouteDefaultTimeout(t *testing.T) {
+	seed := startHangingRouteServer(t)
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTimeout(100*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	begin := time.Now()
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.Error(t, err, "hanging route should fail")
+	require.Less(t, time.Since(begin), 5*time.Second, "route should stop at the default timeout")
+}
+
+func TestConcurrentRouteMissesShareOneRPC(t *testing.T) {
+	var routeCalls int32
+	var mutex sync.Mutex
+	var routedTables [][]string
+	srv := &mockStorageServer{}
+	srv.routeFn = func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		atomic.AddInt32(&routeCalls, 1)
+		mutex.Lock()
+		routedTables = append(routedTables, req.Tables)
+		mutex.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		return routeResponseTo(req.Tables, func(string) string { return srv.addr }), nil
+	}
+	seed := startMockServer(t, srv)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteBatchWindow(100*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	errs := make([]error, 20)
+	successes := make([]uint32, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		points, err := buildTablePoints(fmt.Sprintf("flight_test_%d", i%2), currentMS(), 1)
+		require.NoError(t, err, "build points failed")
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+			errs[i] = err
+			successes[i] = resp.Success
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range errs {
+		require.NoError(t, errs[i], "write points failed")
+		require.Equal(t, uint32(1), successes[i])
+	}
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&routeCalls), "misses should be merged into one Route RPC")
+	require.ElementsMatch(t, []string{"flight_test_0", "flight_test_1"}, routedTables[0])
+}
+
+func TestRouteMissesWithDifferentMetadataNotShared(t *testing.T) {
+	tenants := make(chan string, 4)
+	srv := &mockStorageServer{}
+	srv.routeFn = func(ctx context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		tenants <- md.Get("x-tenant")[0]
+		return routeResponseTo(req.Tables, func(string) string { return srv.addr }), nil
+	}
+	seed := startMockServer(t, srv)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteBatchWindow(100*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	tenantList := []string{"tenant-a", "tenant-b"}
+	errs := make([]error, len(tenantList))
+	var wg sync.WaitGroup
+	for i, tenant := range tenantList {
+		points := buildClusterPoints(t, 1)
+		wg.Add(1)
+		go func(i int, tenant string) {
+			defer wg.Done()
+			_, errs[i] = client.Write(context.Background(), horaedb.WriteRequest{
+				ReqCtx: horaedb.RequestContext{Metadata: map[string]string{"x-tenant": tenant}},
+				Points: points,
+			})
+		}(i, tenant)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err, "write points failed")
+	}
+
+	close(tenants)
+	seen := make([]string, 0, 2)
+	for tenant := range tenants {
+		seen = append(seen, tenant)
+	}
+	require.ElementsMatch(t, tenantList, seen, "every tenant should route with its own metadata")
+}
+
+func TestSharedRouteCanceledWithoutWaiters(t *testing.T) {
+	canceled := make(chan struct{})
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(ctx context.Context, _ *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			<-ctx.Done()
+			close(canceled)
+			return nil, ctx.Err()
+		},
+	})
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTimeout(0),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.Error(t, err, "hanging route should fail")
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "route RPC should be canceled once its caller is gone")
+	}
+}
+
+// nolint
+func countingWriteServer(t *testing.T, writes *int32) string {
+	return startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(writes, 1)
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+}
+
+func TestHotRouteRefreshedBeforeExpiry(t *testing.T) {
+	var oldWrites, newWrites, routeCalls int32
+	oldNode := countingWriteServer(t, &oldWrites)
+	newNode := countingWriteServer(t, &newWrites)
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			if atomic.AddInt32(&routeCalls, 1) == 1 {
+				return routeResponseTo(req.Tables, func(string) string { return oldNode }), nil
+			}
+			// A slow refresh is only noticed by writes when they wait for it.
+			time.Sleep(100 * time.Millisecond)
+			return routeResponseTo(req.Tables, func(string) string { return newNode }), nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTTL(2*time.Second),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	deadline := time.Now().Add(2500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		begin := time.Now()
+		resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+		require.NoError(t, err, "write points failed")
+		require.Equal(t, uint32(1), resp.Success)
+		require.Less(t, time.Since(begin), 80*time.Millisecond, "write should not wait for a route refresh")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	require.Greater(t, atomic.LoadInt32(&oldWrites), int32(0))
+	require.Greater(t, atomic.LoadInt32(&newWrites), int32(0), "hot route should be refreshed in the background")
+}
+
+func TestHotRouteRefreshKeepsMetadata(t *testing.T) {
+	tenants := make(chan string, 16)
+	srv := &mockStorageServer{}
+	srv.routeFn = func(ctx context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		select {
+		case tenants <- strings.Join(md.Get("x-tenant"), ","):
+		default:
+		}
+		return routeResponseTo(req.Tables, func(string) string { return srv.addr }), nil
+	}
+	seed := startMockServer(t, srv)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTTL(200*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	reqCtx := horaedb.RequestContext{Metadata: map[string]string{"x-tenant": "tenant-a"}}
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		_, err := client.Write(context.Background(), horaedb.WriteRequest{ReqCtx: reqCtx, Points: buildClusterPoints(t, 1)})
+		require.NoError(t, err, "write points failed")
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	require.Equal(t, "tenant-a", <-tenants, "the first route should be fetched with the request metadata")
+	select {
+	case tenant := <-tenants:
+		require.Equal(t, "tenant-a", tenant, "hot route should be refreshed with the request metadata")
+	case <-time.After(5 * time.Second):
+		t.Fatal("hot route is not refreshed")
+	}
+}
+
+func TestExpiredRouteServedWhenRefreshFails(t *testing.T) {
+	var writes, routeCalls int32
+	node := countingWriteServer(t, &writes)
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			if atomic.AddInt32(&routeCalls, 1) == 1 {
+				return routeResponseTo(req.Tables, func(string) string { return node }), nil
+			}
+			return &storagepb.RouteResponse{Header: &commonpb.ResponseHeader{Code: 500, Error: "meta unavailable"}}, nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithRouteTTL(100*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+
+	// Not hit for longer than the ttl, so the route is neither hot nor fresh.
+	time.Sleep(300 * time.Millisecond)
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "expired route should be served when refresh fails")
+	require.Equal(t, uint32(1), resp.Success)
+	require.Equal(t, int32(2), atomic.LoadInt32(&writes))
+	// The hot route refresh may also have started after the write hit the expired route.
+	require.GreaterOrEqual(t, atomic.LoadInt32(&routeCalls), int32(2), "expired route should be refreshed first")
+}
+
+func TestRouteCachePerDatabase(t *testing.T) {
+	var writesA, writesB int32
+	nodeA := countingWriteServer(t, &writesA)
+	nodeB := countingWriteServer(t, &writesB)
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			return routeResponseTo(req.Tables, func(string) string {
+				if req.Context.Database == "db_a" {
+					return nodeA
+				}
+				return nodeB
+			}), nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	for _, database := range []string{"db_a", "db_b", "db_a", "db_b"} {
+		points, err := buildTablePoints("cpu", currentMS(), 1)
+		require.NoError(t, err, "build points failed")
+		_, err = client.Write(context.Background(), horaedb.WriteRequest{
+			ReqCtx: horaedb.RequestContext{Database: database},
+			Points: points,
+		})
+		require.NoError(t, err, "write points failed")
+	}
+
+	require.Equal(t, int32(2), atomic.LoadInt32(&writesA))
+	require.Equal(t, int32(2), atomic.LoadInt32(&writesB))
+}
+
+func TestRouteFailoverBetweenSeeds(t *testing.T) {
+	var writes int32
+	node := countingWriteServer(t, &writes)
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			return routeResponseTo(req.Tables, func(string) string { return node }), nil
+		},
+	})
+
+	client, err := horaedb.NewClientWithEndpoints([]string{unreachableEndpoint(t), seed}, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	for i := 0; i < 3; i++ {
+		points, err := buildTablePoints(fmt.Sprintf("failover_test_%d", i), currentMS(), 1)
+		require.NoError(t, err, "build points failed")
+		_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+		require.NoError(t, err, "route should fail over to the reachable seed")
+	}
+	require.Equal(t, int32(3), atomic.LoadInt32(&writes))
+}
+
+func TestUnroutedTablesUseOneSeed(t *testing.T) {
+	unrouted := func(context.Context, *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		return routeResponseTo(nil, nil), nil
+	}
+	dropped := func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+		return &storagepb.SqlQueryResponse{
+			Header: &commonpb.ResponseHeader{Code: 200},
+			Output: &storagepb.SqlQueryResponse_AffectedRows{AffectedRows: 0},
+		}, nil
+	}
+	seedA := startMockServer(t, &mockStorageServer{routeFn: unrouted, sqlQueryFn: dropped})
+	seedB := startMockServer(t, &mockStorageServer{routeFn: unrouted, sqlQueryFn: dropped})
+
+	client, err := horaedb.NewClientWithEndpoints([]string{seedA, seedB}, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{SQL: "DROP TABLE IF EXISTS a, b"})
+		require.NoError(t, err, "unrouted tables of one query should go to one seed")
+	}
+}
+
+func TestProxyEndpointsRoundRobin(t *testing.T) {
+	var writesA, writesB int32
+	proxyA := countingWriteServer(t, &writesA)
+	proxyB := countingWriteServer(t, &writesB)
+
+	client, err := horaedb.NewClientWithEndpoints([]string{proxyA, proxyB}, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	for i := 0; i < 4; i++ {
+		_, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+		require.NoError(t, err, "write points failed")
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&writesA))
+	require.Equal(t, int32(2), atomic.LoadInt32(&writesB))
+}
+
+func TestProxyEndpointSkippedAfterFailure(t *testing.T) {
+	var writes int32
+	proxy := countingWriteServer(t, &writes)
+
+	client, err := horaedb.NewClientWithEndpoints([]string{proxy, unreachableEndpoint(t)}, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	failed := 0
+	for i := 0; i < 6; i++ {
+		resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+		require.NoError(t, err, "write points failed")
+		failed += int(resp.Failed)
+	}
+	require.Equal(t, 1, failed, "the unreachable proxy should only be tried once")
+	require.Equal(t, int32(5), atomic.LoadInt32(&writes))
+}
+
+func TestNewClientWithoutEndpoints(t *testing.T) {
+	_, err := horaedb.NewClientWithEndpoints(nil, horaedb.Direct)
+	require.ErrorIs(t, err, horaedb.ErrNoEndpoints)
+}
@@ -0,0 +1,262 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+// scanQueryResponse has two rows of all the column types, the second row has null host and cpu.
+func scanQueryResponse(t *testing.T) *storagepb.SqlQueryResponse {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ts", Type: arrow.FixedWidthTypes.Timestamp_ms},
+		{Name: "host", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "cpu", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+		{Name: "count", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "cores", Type: arrow.PrimitiveTypes.Int32},
+		{Name: "online", Type: arrow.FixedWidthTypes.Boolean},
+		{Name: "raw", Type: arrow.BinaryTypes.Binary},
+		{Name: "bytes", Type: arrow.PrimitiveTypes.Uint64},
+	}, nil)
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1700000000000, 1700000001000}, nil)
+	builder.Field(1).(*array.StringBuilder).AppendValues([]string{"host-a", ""}, []bool{true, false})
+	builder.Field(2).(*array.Float64Builder).AppendValues([]float64{0.5, 0}, []bool{true, false})
+	builder.Field(3).(*array.Int64Builder).AppendValues([]int64{10, 1000}, nil)
+	builder.Field(4).(*array.Int32Builder).AppendValues([]int32{4, 8}, nil)
+	builder.Field(5).(*array.BooleanBuilder).AppendValues([]bool{true, false}, nil)
+	builder.Field(6).(*array.BinaryBuilder).AppendValues([][]byte{{1, 2}, {3}}, nil)
+	builder.Field(7).(*array.Uint64Builder).AppendValues([]uint64{1 << 40, 7}, nil)
+	record := builder.NewRecord()
+	defer record.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	require.NoError(t, writer.Write(record), "write arrow record failed")
+	require.NoError(t, writer.Close(), "close arrow writer failed")
+
+	return &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_Arrow{Arrow: &storagepb.ArrowPayload{RecordBatches: [][]byte{buf.Bytes()}}},
+	}
+}
+
+func queryScanRows(t *testing.T) horaedb.SQLQueryResponse {
+	resp := scanQueryResponse(t)
+	endpoint := startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			return resp, nil
+		},
+		streamQueryResponses: []*storagepb.SqlQueryResponse{resp},
+	})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	t.Cleanup(func() {
+		_ = client.Close(context.Background())
+	})
+
+	queryResp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{Tables: []string{"cpu"}, SQL: "select * from cpu"})
+	require.NoError(t, err, "query failed")
+	return queryResp
+}
+
+type scanMetric struct {
+	Time    time.Time `horaedb:"ts"`
+	Host    *string   `horaedb:"host"`
+	CPU     *float64  `horaedb:"cpu"`
+	Count   int       `horaedb:"count"`
+	Cores   int16     `horaedb:"cores"`
+	Online  bool      `horaedb:"online"`
+	Raw     []byte    `horaedb:"raw"`
+	Bytes   float64   `horaedb:"bytes"`
+	Ignored string    `horaedb:"-"`
+	Missing string    `horaedb:"not_exist"`
+}
+
+func TestQueryResponseScan(t *testing.T) {
+	resp := queryScanRows(t)
+
+	var metrics []scanMetric
+	require.NoError(t, resp.Scan(&metrics), "scan rows failed")
+	require.Len(t, metrics, 2)
+
+	host := "host-a"
+	cpu := 0.5
+	require.Equal(t, scanMetric{
+		Time:   time.UnixMilli(1700000000000),
+		Host:   &host,
+		CPU:    &cpu,
+		Count:  10,
+		Cores:  4,
+		Online: true,
+		Raw:    []byte{1, 2},
+		Bytes:  float64(1 << 40),
+	}, metrics[0])
+	require.Nil(t, metrics[1].Host, "null should scan into nil pointer")
+	require.Nil(t, metrics[1].CPU, "null should scan into nil pointer")
+	require.Equal(t, time.UnixMilli(1700000001000), metrics[1].Time)
+
+	var pointers []*scanMetric
+	require.NoError(t, resp.Scan(&pointers), "scan rows into pointers failed")
+	require.Len(t, pointers, 2)
+	require.Equal(t, metrics[1], *pointers[1])
+}
+
+func TestRowScan(t *testing.T) {
+	resp := queryScanRows(t)
+
+	var untagged struct {
+		Ts    int64
+		Count uint32 `horaedb:"count"`
+		Host  string `horaedb:"host"`
+	}
+	require.NoError(t, resp.Rows[1].Scan(&untagged), "scan row failed")
+	require.Equal(t, int64(1700000001000), untagged.Ts)
+	require.Equal(t, uint32(1000), untagged.Count)
+	require.Equal(t, "", untagged.Host, "null should scan into zero value")
+
+	var mismatch struct {
+		Host int `horaedb:"host"`
+	}
+	err := resp.Rows[0].Scan(&mismatch)
+	require.ErrorIs(t, err, horaedb.ErrScanTypeMismatch)
+	require.Contains(t, err.Error(), "host")
+
+	var overflow struct {
+		Count int8 `horaedb:"count"`
+	}
+	require.NoError(t, resp.Rows[0].Scan(&overflow), "10 fits in int8")
+	require.ErrorIs(t, resp.Rows[1].Scan(&overflow), horaedb.ErrScanTypeMismatch, "1000 overflows int8")
+
+	require.ErrorIs(t, resp.Rows[0].Scan(untagged), horaedb.ErrScanDest)
+	var notSlice scanMetric
+	require.ErrorIs(t, resp.Scan(&notSlice), horaedb.ErrScanDest)
+}
+
+func TestRowIteratorScan(t *testing.T) {
+	resp := scanQueryResponse(t)
+	endpoint := startMockServer(t, &mockStorageServer{
+		streamQueryResponses: []*storagepb.SqlQueryResponse{resp, resp},
+	})
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	it, err := client.(horaedb.QueryStreamClient).QueryStream(context.Background(), horaedb.SQLQueryRequest{Tables: []string{"cpu"}, SQL: "select * from cpu"})
+	require.NoError(t, err, "query stream failed")
+	defer it.Close()
+
+	var counts []int
+	for it.Next() {
+		var metric scanMetric
+		require.NoError(t, it.Row().Scan(&metric), "scan row failed")
+		counts = append(counts, metric.Count)
+	}
+	require.NoError(t, it.Err())
+	require.Equal(t, []int{10, 1000, 10, 1000}, counts)
+}
+
+// timestampUnitsServer answers every query with one row of second, microsecond and null nanosecond timestamps.
+func timestampUnitsServer(t *testing.T) string {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "ts_s", Type: arrow.FixedWidthTypes.Timestamp_s},
+		{Name: "ts_us", Type: arrow.FixedWidthTypes.Timestamp_us},
+		{Name: "ts_ns", Type: arrow.FixedWidthTypes.Timestamp_ns, Nullable: true},
+	}, nil)
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+	builder.Field(0).(*array.TimestampBuilder).Append(1700000000)
+	builder.Field(1).(*array.TimestampBuilder).Append(1700000000123000)
+	builder.Field(2).(*array.TimestampBuilder).AppendNull()
+	record := builder.NewRecord()
+	defer record.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	require.NoError(t, writer.Write(record), "write arrow record failed")
+	require.NoError(t, writer.Close(), "close arrow writer failed")
+	resp := &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_Arrow{Arrow: &storagepb.ArrowPayload{RecordBatches: [][]byte{buf.Bytes()}}},
+	}
+	return startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(context.Context, *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			return resp, nil
+		},
+	})
+}
+
+func testQueryTimestampUnits(t *testing.T, client horaedb.Client, expectType horaedb.DataType) {
+	queryResp, err := client.SQLQuery(context.Background(), horaedb.SQLQueryRequest{Tables: []string{"cpu"}, SQL: "select * from cpu"})
+	require.NoError(t, err, "query failed")
+	require.Len(t, queryResp.Rows, 1)
+
+	for _, column := range queryResp.Schema {
+		require.Equal(t, expectType, column.DataType, column.Name)
+	}
+	row := queryResp.Rows[0]
+	seconds, _ := row.Column("ts_s")
+	require.Equal(t, int64(1700000000000), seconds.Value().Int64Value(), "seconds should convert to ms")
+	require.Equal(t, expectType, seconds.Value().DataType())
+	micros, _ := row.Column("ts_us")
+	require.Equal(t, int64(1700000000123), micros.Value().Int64Value(), "microseconds should convert to ms")
+	require.Equal(t, expectType, micros.Value().DataType())
+	nanos, _ := row.Column("ts_ns")
+	require.True(t, nanos.Value().IsNull())
+}
+
+func TestQueryTimestampUnitsAsInt64(t *testing.T) {
+	client, err := horaedb.NewClient(timestampUnitsServer(t), horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	testQueryTimestampUnits(t, client, horaedb.INT64)
+}
+
+func TestQueryTimestampUnitsAsTimestamp(t *testing.T) {
+	client, err := horaedb.NewClient(timestampUnitsServer(t), horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithTimestampDataType(true),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	testQueryTimestampUnits(t, client, horaedb.TIMESTAMP)
+}
@@ -0,0 +1,148 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/quick"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+// tagSets is a random batch of tag sets drawn from tiny alphabets, so concatenated names and values often look alike.
+type tagSets []map[string]*string
+
+func (tagSets) Generate(r *rand.Rand, size int) reflect.Value {
+	names := []string{"a", "b", "ab", "ba"}
+	values := []string{"", "x", "y", "xy", "yx", "xyz", "z"}
+
+	sets := make(tagSets, 1+r.Intn(size+1))
+	for i := range sets {
+		set := map[string]*string{}
+		for _, name := range names {
+			switch r.Intn(4) {
+			case 0: // missing
+			case 1:
+				set[name] = nil // null
+			default:
+				value := values[r.Intn(len(values))]
+				set[name] = &value
+			}
+		}
+		// Every point needs at least one tag.
+		if len(set) == 0 {
+			value := values[r.Intn(len(values))]
+			set[names[0]] = &value
+		}
+		sets[i] = set
+	}
+	return reflect.ValueOf(sets)
+}
+
+// nonNullTags is how a tag set is written, null and missing tags both leave the tag out.
+func nonNullTags(set map[string]*string) map[string]string {
+	tags := map[string]string{}
+	for name, value := range set {
+		if value != nil {
+			tags[name] = *value
+		}
+	}
+	return tags
+}
+
+func TestSeriesKeyNeverMergesDistinctTags(t *testing.T) {
+	var mutex sync.Mutex
+	var captured *storagepb.WriteRequest
+	seed := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			mutex.Lock()
+			captured = req
+			mutex.Unlock()
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	property := func(sets tagSets) bool {
+		points := make([]horaedb.Point, 0, len(sets))
+		for idx, set := range sets {
+			builder := horaedb.NewPointBuilder("series_test").
+				// The timestamp identifies the point in the written request.
+				SetTimestamp(int64(idx+1)).
+				AddField("value", horaedb.NewInt64Value(int64(idx)))
+			for name, value := range set {
+				if value == nil {
+					builder.AddTag(name, horaedb.NewStringNullValue())
+				} else {
+					builder.AddTag(name, horaedb.NewStringValue(*value))
+				}
+			}
+			point, err := builder.Build()
+			require.NoError(t, err, "build point failed")
+			points = append(points, point)
+		}
+
+		resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+		if err != nil || resp.Success != uint32(len(points)) {
+			return false
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		seen := 0
+		for _, tableReq := range captured.TableRequests {
+			entrySets := map[string]bool{}
+			for _, entry := range tableReq.Entries {
+				written := map[string]string{}
+				for _, tag := range entry.Tags {
+					written[tableReq.TagNames[tag.NameIndex]] = tag.Value.GetStringValue()
+				}
+				// One entry per distinct tag set.
+				key := fmt.Sprintf("%q", written)
+				if entrySets[key] {
+					return false
+				}
+				entrySets[key] = true
+
+				for _, fieldGroup := range entry.FieldGroups {
+					seen++
+					if !reflect.DeepEqual(written, nonNullTags(sets[fieldGroup.Timestamp-1])) {
+						return false
+					}
+				}
+			}
+		}
+		return seen == len(points)
+	}
+
+	require.NoError(t, quick.Check(property, &quick.Config{MaxCount: 200}))
+}
@@ -0,0 +1,125 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"testing"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractTables(t *testing.T) {
+	cases := []struct {
+		name   string
+		sql    string
+		tables []string
+	}{
+		// SELECT
+		{"simple select", "SELECT * FROM demo", []string{"demo"}},
+		{"lower case keywords", "select * from demo where t > 1", []string{"demo"}},
+		{"trailing semicolon", "SELECT * FROM demo;", []string{"demo"}},
+		{"alias", "SELECT d.value FROM demo d WHERE d.t > 0", []string{"demo"}},
+		{"alias with as", "SELECT d.value FROM demo AS d", []string{"demo"}},
+		{"comma list", "SELECT * FROM a, b AS y, c z WHERE a.t = y.t", []string{"a", "b", "c"}},
+		{"qualified name", "SELECT * FROM public.demo", []string{"demo"}},
+		{"double quoted", `SELECT * FROM "Demo Table"`, []string{"Demo Table"}},
+		{"back quoted", "SELECT * FROM `demo-1`", []string{"demo-1"}},
+		{"quoted with escaped quote", `SELECT * FROM "a""b"`, []string{`a"b`}},
+		{"quoted qualified name", "SELECT * FROM `public`.`demo`", []string{"demo"}},
+		{"quoted alias", `SELECT * FROM demo "d"`, []string{"demo"}},
+		{"case preserved", "SELECT * FROM CPU_Usage", []string{"CPU_Usage"}},
+		{"duplicates removed", "SELECT * FROM demo UNION ALL SELECT * FROM demo", []string{"demo"}},
+		{"union", "SELECT t FROM a UNION SELECT t FROM b EXCEPT SELECT t FROM c", []string{"a", "b", "c"}},
+		{"group order limit", "SELECT host, avg(v) FROM cpu GROUP BY host ORDER BY host DESC LIMIT 10", []string{"cpu"}},
+
+		// Joins
+		{"join", "SELECT * FROM a JOIN b ON a.t = b.t", []string{"a", "b"}},
+		{"left outer join", "SELECT * FROM a LEFT OUTER JOIN b ON a.t = b.t", []string{"a", "b"}},
+		{"several joins", "SELECT * FROM a INNER JOIN b USING (t) RIGHT JOIN c ON b.t = c.t FULL JOIN d ON c.t = d.t", []string{"a", "b", "c", "d"}},
+		{"cross join", "SELECT * FROM a CROSS JOIN b", []string{"a", "b"}},
+		{"join with alias", "SELECT * FROM a x JOIN b AS y ON x.t = y.t", []string{"a", "b"}},
+		{"join quoted", "SELECT * FROM `a` JOIN \"b\" ON `a`.t = \"b\".t", []string{"a", "b"}},
+
+		// Subqueries and CTEs
+		{"subquery in from", "SELECT * FROM (SELECT * FROM inner_t) AS s", []string{"inner_t"}},
+		{"subquery without alias", "SELECT * FROM (SELECT * FROM inner_t)", []string{"inner_t"}},
+		{"subquery and table", "SELECT * FROM (SELECT t FROM a) s, b WHERE s.t = b.t", []string{"a", "b"}},
+		{"subquery in where", "SELECT * FROM a WHERE t IN (SELECT t FROM b)", []string{"a", "b"}},
+		{"exists subquery", "SELECT * FROM a WHERE EXISTS (SELECT 1 FROM b WHERE b.t = a.t)", []string{"a", "b"}},
+		{"nested subqueries", "SELECT * FROM (SELECT * FROM (SELECT * FROM deep) x) y", []string{"deep"}},
+		{"cte", "WITH recent AS (SELECT * FROM demo WHERE t > 0) SELECT * FROM recent", []string{"demo"}},
+		{"several ctes", "WITH a1 AS (SELECT * FROM a), b1 (t) AS (SELECT t FROM b) SELECT * FROM a1 JOIN b1 ON a1.t = b1.t", []string{"a", "b"}},
+		{"recursive cte", "WITH RECURSIVE r AS (SELECT * FROM base) SELECT * FROM r", []string{"base"}},
+
+		// FROM which is not a table
+		{"extract from", "SELECT EXTRACT(YEAR FROM t) FROM demo", []string{"demo"}},
+		{"substring from", "SELECT SUBSTRING(name FROM 1 FOR 2) FROM demo", []string{"demo"}},
+		{"trim from", "SELECT TRIM(BOTH 'x' FROM name) FROM demo", []string{"demo"}},
+		{"is distinct from", "SELECT * FROM demo WHERE a IS DISTINCT FROM b", []string{"demo"}},
+		{"from in string", "SELECT 'FROM fake' FROM demo", []string{"demo"}},
+		{"from in line comment", "SELECT * -- FROM fake\nFROM demo", []string{"demo"}},
+		{"from in block comment", "SELECT * /* FROM fake */ FROM demo", []string{"demo"}},
+		{"from as quoted column", `SELECT "from" FROM demo`, []string{"demo"}},
+		{"table function", "SELECT * FROM generate_series(1, 10)", nil},
+
+		// INSERT
+		{"insert values", "INSERT INTO demo (t, name, value) VALUES (1, 'a', 1.0)", []string{"demo"}},
+		{"insert without columns", "INSERT INTO demo VALUES (1, 'a', 1.0)", []string{"demo"}},
+		{"insert quoted", "INSERT INTO `my demo`(t) VALUES (1)", []string{"my demo"}},
+		{"insert select", "INSERT INTO dst SELECT * FROM src", []string{"dst", "src"}},
+
+		// CREATE, DROP, ALTER
+		{"create table", "CREATE TABLE demo (name string TAG, value double, t timestamp NOT NULL, TIMESTAMP KEY(t)) ENGINE=Analytic", []string{"demo"}},
+		{"create if not exists", "CREATE TABLE IF NOT EXISTS `demo` (t timestamp NOT NULL, TIMESTAMP KEY(t))", []string{"demo"}},
+		{"create with options", "CREATE TABLE demo (t timestamp NOT NULL, TIMESTAMP KEY(t)) ENGINE=Analytic WITH (enable_ttl='false')", []string{"demo"}},
+		{"drop table", "DROP TABLE demo", []string{"demo"}},
+		{"drop if exists", "DROP TABLE IF EXISTS demo", []string{"demo"}},
+		{"drop several", "DROP TABLE IF EXISTS a, b", []string{"a", "b"}},
+		{"alter add column", "ALTER TABLE demo ADD COLUMN (c string)", []string{"demo"}},
+		{"alter modify setting", "ALTER TABLE `demo` MODIFY SETTING enable_ttl='false'", []string{"demo"}},
+
+		// DESCRIBE, EXISTS, SHOW
+		{"describe", "DESCRIBE demo", []string{"demo"}},
+		{"describe table", "DESCRIBE TABLE demo", []string{"demo"}},
+		{"desc", "DESC demo", []string{"demo"}},
+		{"exists table", "EXISTS TABLE demo", []string{"demo"}},
+		{"show create table", "SHOW CREATE TABLE demo", []string{"demo"}},
+		{"show create quoted", `SHOW CREATE TABLE "demo"`, []string{"demo"}},
+		{"show tables", "SHOW TABLES", nil},
+		{"show tables like", "SHOW TABLES LIKE 'demo%'", nil},
+
+		// Several statements and malformed sql
+		{"two statements", "DROP TABLE a; CREATE TABLE b (t timestamp NOT NULL, TIMESTAMP KEY(t))", []string{"a", "b"}},
+		{"desc after semicolon", "SELECT 1; DESC demo", []string{"demo"}},
+		{"empty", "", nil},
+		{"no table", "SELECT 1 + 1", nil},
+		{"dangling from", "SELECT * FROM", nil},
+		{"unterminated quote", "SELECT * FROM `demo", []string{"demo"}},
+		{"unterminated comment", "SELECT * FROM demo /* comment", []string{"demo"}},
+		{"unbalanced parens", "SELECT * FROM (SELECT * FROM demo", []string{"demo"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Equal(t, c.tables, horaedb.ExtractTables(c.sql), "sql:%s", c.sql)
+		})
+	}
+}
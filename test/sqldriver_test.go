@@ -0,0 +1,219 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/horaedb-client-go/horaedb/sqldriver"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+)
+
+// openSQLDB opens a sql.DB on a mock server answering every query with resp, and records the requests.
+func openSQLDB(t *testing.T, resp *storagepb.SqlQueryResponse) (*sql.DB, func() []*storagepb.SqlQueryRequest) {
+	var mutex sync.Mutex
+	var reqs []*storagepb.SqlQueryRequest
+	endpoint := startMockServer(t, &mockStorageServer{
+		sqlQueryFn: func(_ context.Context, req *storagepb.SqlQueryRequest) (*storagepb.SqlQueryResponse, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			reqs = append(reqs, req)
+			return resp, nil
+		},
+	})
+
+	db, err := sql.Open("horaedb", "horaedb://"+endpoint+"/public?route_mode=proxy&query_timeout=5s")
+	require.NoError(t, err, "open sql db failed")
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	return db, func() []*storagepb.SqlQueryRequest {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]*storagepb.SqlQueryRequest(nil), reqs...)
+	}
+}
+
+func TestSQLDriverQuery(t *testing.T) {
+	db, requests := openSQLDB(t, scanQueryResponse(t))
+
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM cpu")
+	require.NoError(t, err, "query failed")
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	require.NoError(t, err)
+	require.Equal(t, []string{"ts", "host", "cpu", "count", "cores", "online", "raw", "bytes"}, columns)
+
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	typeNames := make([]string, len(types))
+	scanTypes := make([]reflect.Type, len(types))
+	for idx, typ := range types {
+		typeNames[idx] = typ.DatabaseTypeName()
+		scanTypes[idx] = typ.ScanType()
+	}
+	require.Equal(t, []string{"TIMESTAMP", "STRING", "DOUBLE", "INT64", "INT32", "BOOL", "VARBINARY", "UINT64"}, typeNames)
+	require.Equal(t, []reflect.Type{
+		reflect.TypeOf(time.Time{}), reflect.TypeOf(""), reflect.TypeOf(float64(0)), reflect.TypeOf(int64(0)),
+		reflect.TypeOf(int64(0)), reflect.TypeOf(false), reflect.TypeOf([]byte(nil)), reflect.TypeOf(uint64(0)),
+	}, scanTypes, "scan types should be the types of the driver values")
+	nullable, ok := types[1].Nullable()
+	require.True(t, ok)
+	require.True(t, nullable, "host should be nullable")
+
+	type result struct {
+		ts     time.Time
+		host   sql.NullString
+		cpu    sql.NullFloat64
+		count  int64
+		cores  int32
+		online bool
+		raw    []byte
+		bytes  uint64
+	}
+	var results []result
+	for rows.Next() {
+		var r result
+		require.NoError(t, rows.Scan(&r.ts, &r.host, &r.cpu, &r.count, &r.cores, &r.online, &r.raw, &r.bytes))
+		results = append(results, r)
+	}
+	require.NoError(t, rows.Err())
+	require.Len(t, results, 2)
+	require.Equal(t, result{
+		ts:     time.UnixMilli(1700000000000),
+		host:   sql.NullString{String: "host-a", Valid: true},
+		cpu:    sql.NullFloat64{Float64: 0.5, Valid: true},
+		count:  10,
+		cores:  4,
+		online: true,
+		raw:    []byte{1, 2},
+		bytes:  1 << 40,
+	}, results[0])
+	require.False(t, results[1].host.Valid, "null host should scan as invalid")
+	require.False(t, results[1].cpu.Valid, "null cpu should scan as invalid")
+
+	reqs := requests()
+	require.Len(t, reqs, 1)
+	require.Equal(t, []string{"cpu"}, reqs[0].Tables, "tables should be derived from the sql")
+	require.Equal(t, "public", reqs[0].Context.Database)
+}
+
+func TestSQLDriverEmptyQuery(t *testing.T) {
+	db, _ := openSQLDB(t, &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_Arrow{Arrow: &storagepb.ArrowPayload{}},
+	})
+
+	rows, err := db.QueryContext(context.Background(), "SELECT * FROM cpu WHERE host = 'none'")
+	require.NoError(t, err, "query without rows should not fail")
+	defer rows.Close()
+	require.False(t, rows.Next())
+	require.NoError(t, rows.Err())
+
+	var count int64
+	err = db.QueryRowContext(context.Background(), "SELECT count(*) FROM cpu").Scan(&count)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestSQLDriverExec(t *testing.T) {
+	db, requests := openSQLDB(t, &storagepb.SqlQueryResponse{
+		Header: &commonpb.ResponseHeader{Code: 200},
+		Output: &storagepb.SqlQueryResponse_AffectedRows{AffectedRows: 3},
+	})
+
+	result, err := db.ExecContext(context.Background(), "INSERT INTO demo (t, name, value) VALUES (1, 'a', 1.0)")
+	require.NoError(t, err, "exec failed")
+	affected, err := result.RowsAffected()
+	require.NoError(t, err)
+	require.Equal(t, int64(3), affected)
+
+	_, err = db.ExecContext(context.Background(), "DROP TABLE IF EXISTS demo", sqldriver.Tables("hinted"))
+	require.NoError(t, err, "exec with tables hint failed")
+
+	_, err = db.ExecContext(context.Background(), "DROP TABLE demo", 1)
+	require.ErrorIs(t, err, sqldriver.ErrArgsNotSupported)
+
+	_, err = db.Begin()
+	require.ErrorIs(t, err, sqldriver.ErrTxNotSupported)
+
+	reqs := requests()
+	require.Len(t, reqs, 2)
+	require.Equal(t, []string{"demo"}, reqs[0].Tables)
+	require.Equal(t, []string{"hinted"}, reqs[1].Tables)
+}
+
+func TestParseDSN(t *testing.T) {
+	cases := []struct {
+		dsn       string
+		endpoints []string
+		mode      horaedb.RouteMode
+		database  string
+		options   int
+		wantErr   bool
+	}{
+		{dsn: "horaedb://127.0.0.1:8831", endpoints: []string{"127.0.0.1:8831"}, mode: horaedb.Direct},
+		{dsn: "horaedb://a:8831,b:8831/public", endpoints: []string{"a:8831", "b:8831"}, mode: horaedb.Direct, database: "public"},
+		{dsn: "horaedb://a:8831/public?route_mode=proxy", endpoints: []string{"a:8831"}, mode: horaedb.Proxy, database: "public"},
+		{
+			dsn:       "horaedb://a:8831/?query_timeout=5s&route_timeout=1s&route_ttl=1m&max_recv_msg_size=1024",
+			endpoints: []string{"a:8831"},
+			mode:      horaedb.Direct,
+			options:   4,
+		},
+		{
+			dsn:       "horaedb://a:8831/public?tls=true&tls_ca_file=ca.pem&tls_server_name=horaedb&tls_cert_file=c.pem&tls_key_file=k.pem",
+			endpoints: []string{"a:8831"},
+			mode:      horaedb.Direct,
+			database:  "public",
+			options:   4,
+		},
+		{dsn: "mysql://a:3306/public", wantErr: true},
+		{dsn: "horaedb:///public", wantErr: true},
+		{dsn: "horaedb://a:8831/public?route_mode=cluster", wantErr: true},
+		{dsn: "horaedb://a:8831/public?query_timeout=5", wantErr: true},
+		{dsn: "horaedb://a:8831/public?max_recv_msg_size=-1", wantErr: true},
+		{dsn: "horaedb://a:8831/public?tls=maybe", wantErr: true},
+		{dsn: "horaedb://a:8831/public?tls_cert_file=c.pem", wantErr: true},
+		{dsn: "horaedb://a:8831/public?unknown=1", wantErr: true},
+		{dsn: "horaedb://a:8831/public/extra", wantErr: true},
+	}
+
+	for _, c := range cases {
+		cfg, err := sqldriver.ParseDSN(c.dsn)
+		if c.wantErr {
+			require.Error(t, err, "dsn:%s", c.dsn)
+			continue
+		}
+		require.NoError(t, err, "dsn:%s", c.dsn)
+		require.Equal(t, c.endpoints, cfg.Endpoints, "dsn:%s", c.dsn)
+		require.Equal(t, c.mode, cfg.RouteMode, "dsn:%s", c.dsn)
+		require.Equal(t, c.database, cfg.Database, "dsn:%s", c.dsn)
+		require.Len(t, cfg.Options, c.options, "dsn:%s", c.dsn)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// nolint
+func issueTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err, "generate key failed")
+
+	parentCert, parentKey := template, key
+	if parent != nil {
+		parentCert, parentKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err, "create certificate failed")
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err, "parse certificate failed")
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err, "marshal key failed")
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+// nolint
+func certTemplate(serial int64, commonName string, isCA bool) *x509.Certificate {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if !isCA {
+		template.DNSNames = []string{commonName}
+	}
+	return template
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := issueTestCert(t, certTemplate(1, "horaedb-test-ca", true), nil)
+	serverCert := issueTestCert(t, certTemplate(2, "horaedb.test", false), ca)
+	clientCert := issueTestCert(t, certTemplate(3, "horaedb-client", false), ca)
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client.key")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(certFile, clientCert.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, clientCert.keyPEM, 0o600))
+
+	serverKeyPair, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+	require.NoError(t, err, "load server key pair failed")
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+	seed := startMockServer(t, &mockStorageServer{}, grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverKeyPair},
+		ClientCAs:    clientCAs,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})))
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithTLSCAFile(caFile),
+		horaedb.WithTLSClientCertFile(certFile, keyFile),
+		horaedb.WithTLSServerName("horaedb.test"),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(1), resp.Success, resp.Message)
+
+	_, err = horaedb.NewClient(seed, horaedb.Direct, horaedb.WithTLSCAFile(filepath.Join(dir, "missing.pem")))
+	require.Error(t, err, "missing ca file should be reported")
+}
+
+func TestTLSVerifiesDialedHost(t *testing.T) {
+	ca := issueTestCert(t, certTemplate(1, "horaedb-test-ca", true), nil)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0o600))
+
+	startServer := func(ip string) string {
+		template := certTemplate(2, "horaedb.test", false)
+		template.IPAddresses = []net.IP{net.ParseIP(ip)}
+		serverCert := issueTestCert(t, template, ca)
+		serverKeyPair, err := tls.X509KeyPair(serverCert.certPEM, serverCert.keyPEM)
+		require.NoError(t, err, "load server key pair failed")
+		return startMockServer(t, &mockStorageServer{}, grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{serverKeyPair},
+			MinVersion:   tls.VersionTLS12,
+		})))
+	}
+	write := func(seed string) error {
+		client, err := horaedb.NewClient(seed, horaedb.Direct,
+			horaedb.WithDefaultDatabase("public"),
+			horaedb.WithTLSCAFile(caFile),
+		)
+		require.NoError(t, err, "init horaedb client failed")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_, err = client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+		return err
+	}
+
+	require.NoError(t, write(startServer("127.0.0.1")), "certificate for the dialed ip should be accepted")
+	require.Error(t, write(startServer("10.0.0.1")), "certificate for another ip should be rejected")
+}
@@ -0,0 +1,350 @@
+/*
+ * Licensed to the Apache Software Foundation (ASF) under one
+ * or more contributor license agreements.  See the NOTICE file
+ * distributed with this work for additional information
+ * regarding copyright ownership.  The ASF licenses this file
+ * to you under the Apache License, Version 2.0 (the
+ * "License"); you may not use this file except in compliance
+ * with the License.  You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+package test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/apache/horaedb-client-go/horaedb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/commonpb"
+	"github.com/apache/incubator-horaedb-proto/golang/pkg/storagepb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// nolint
+func startWriteCluster(t *testing.T, nodes int, writeFn func(context.Context, *storagepb.WriteRequest) (*storagepb.WriteResponse, error)) (string, []string) {
+	nodeAddrs := make([]string, 0, nodes)
+	for i := 0; i < nodes; i++ {
+		nodeAddrs = append(nodeAddrs, startMockServer(t, &mockStorageServer{writeFn: writeFn}))
+	}
+
+	seed := &mockStorageServer{}
+	seed.routeFn = func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+		return routeResponseTo(req.Tables, func(table string) string {
+			var idx int
+			_, _ = fmt.Sscanf(table, "table_%d", &idx)
+			return nodeAddrs[idx%len(nodeAddrs)]
+		}), nil
+	}
+	return startMockServer(t, seed), nodeAddrs
+}
+
+// nolint
+func buildClusterPoints(t *testing.T, tables int) []horaedb.Point {
+	points := make([]horaedb.Point, 0, tables)
+	for i := 0; i < tables; i++ {
+		tablePoints, err := buildTablePoints(fmt.Sprintf("table_%d", i), currentMS(), 1)
+		require.NoError(t, err, "build points failed")
+		points = append(points, tablePoints...)
+	}
+	return points
+}
+
+func TestWriteConcurrencyLimit(t *testing.T) {
+	var inFlight, maxInFlight int32
+	writeFn := func(_ context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+		cur := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			old := atomic.LoadInt32(&maxInFlight)
+			if cur <= old || atomic.CompareAndSwapInt32(&maxInFlight, old, cur) {
+				break
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+		return (&mockStorageServer{}).Write(context.Background(), req)
+	}
+	seed, _ := startWriteCluster(t, 4, writeFn)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithWriteConcurrency(2),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 4)})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(4), resp.Success)
+	require.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight), "endpoints should be written in parallel up to the limit")
+}
+
+func TestWriteCanceledByContext(t *testing.T) {
+	writeFn := func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	seed, _ := startWriteCluster(t, 3, writeFn)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	resp, err := client.Write(ctx, horaedb.WriteRequest{Points: buildClusterPoints(t, 3)})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, uint32(3), resp.Failed)
+}
+
+func TestStreamWrite(t *testing.T) {
+	seed, _ := startWriteCluster(t, 2, nil)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	writer, err := client.(horaedb.StreamWriteClient).StreamWrite(context.Background(), horaedb.RequestContext{})
+	require.NoError(t, err, "open stream writer failed")
+	for i := 0; i < 3; i++ {
+		require.NoError(t, writer.Write(buildClusterPoints(t, 2)), "stream write failed")
+	}
+
+	resp, err := writer.Close()
+	require.NoError(t, err, "close stream writer failed")
+	require.Equal(t, uint32(6), resp.Success)
+	require.Equal(t, uint32(0), resp.Failed)
+
+	require.ErrorIs(t, writer.Write(buildClusterPoints(t, 1)), horaedb.ErrStreamWriterClosed)
+}
+
+func TestStreamWriteKeepsProxyStreams(t *testing.T) {
+	var mutex sync.Mutex
+	var closed []uint32
+	onClosed := func(rows uint32) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		closed = append(closed, rows)
+	}
+	proxyA := startMockServer(t, &mockStorageServer{streamWriteClosed: onClosed})
+	proxyB := startMockServer(t, &mockStorageServer{streamWriteClosed: onClosed})
+
+	client, err := horaedb.NewClientWithEndpoints([]string{proxyA, proxyB}, horaedb.Proxy, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	writer, err := client.(horaedb.StreamWriteClient).StreamWrite(context.Background(), horaedb.RequestContext{})
+	require.NoError(t, err, "open stream writer failed")
+	for i := 0; i < 4; i++ {
+		require.NoError(t, writer.Write(buildClusterPoints(t, 1)), "stream write failed")
+	}
+	resp, err := writer.Close()
+	require.NoError(t, err, "close stream writer failed")
+	require.Equal(t, uint32(4), resp.Success)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	require.Len(t, closed, 2, "every proxy stream should stay open until Close")
+}
+
+func TestStreamWriteClosesUnroutedStream(t *testing.T) {
+	closedA := make(chan uint32, 1)
+	nodeA := startMockServer(t, &mockStorageServer{streamWriteClosed: func(rows uint32) { closedA <- rows }})
+	nodeB := startMockServer(t, &mockStorageServer{})
+
+	var target atomic.Value
+	target.Store(nodeA)
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			return routeResponseTo(req.Tables, func(string) string { return target.Load().(string) }), nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct,
+		horaedb.WithDefaultDatabase("public"), horaedb.WithRouteTTL(50*time.Millisecond))
+	require.NoError(t, err, "init horaedb client failed")
+
+	writer, err := client.(horaedb.StreamWriteClient).StreamWrite(context.Background(), horaedb.RequestContext{})
+	require.NoError(t, err, "open stream writer failed")
+	require.NoError(t, writer.Write(buildClusterPoints(t, 2)), "stream write failed")
+
+	// The tables move to nodeB, the stream to nodeA has no routes left and is closed by the next write.
+	target.Store(nodeB)
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, writer.Write(buildClusterPoints(t, 2)), "stream write failed")
+	select {
+	case rows := <-closedA:
+		require.Equal(t, uint32(2), rows)
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream without routes is not closed")
+	}
+
+	resp, err := writer.Close()
+	require.NoError(t, err, "close stream writer failed")
+	require.Equal(t, uint32(4), resp.Success, "the response of the closed stream should be kept")
+}
+
+func TestCloseDrainsInflightWrites(t *testing.T) {
+	started := make(chan struct{})
+	writeFn := func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		return (&mockStorageServer{}).Write(ctx, req)
+	}
+	seed, _ := startWriteCluster(t, 1, writeFn)
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	points := buildClusterPoints(t, 1)
+	written := make(chan horaedb.WriteResponse, 1)
+	go func() {
+		resp, _ := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+		written <- resp
+	}()
+
+	<-started
+	begin := time.Now()
+	require.NoError(t, client.Close(context.Background()), "close client failed")
+	require.GreaterOrEqual(t, time.Since(begin), 100*time.Millisecond, "close should wait for the inflight write")
+	resp := <-written
+	require.Equal(t, uint32(1), resp.Success, "inflight write should not be canceled")
+
+	_, err = client.Write(context.Background(), horaedb.WriteRequest{Points: buildClusterPoints(t, 1)})
+	require.ErrorIs(t, err, horaedb.ErrClientClosed)
+	require.NoError(t, client.Close(context.Background()), "close twice should be fine")
+}
+
+func TestWriteReportsFailedPoints(t *testing.T) {
+	healthy := startMockServer(t, &mockStorageServer{})
+	broken := startMockServer(t, &mockStorageServer{
+		writeFn: func(context.Context, *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			return &storagepb.WriteResponse{Header: &commonpb.ResponseHeader{Code: 500, Error: "disk full"}}, nil
+		},
+	})
+	seed := startMockServer(t, &mockStorageServer{
+		routeFn: func(_ context.Context, req *storagepb.RouteRequest) (*storagepb.RouteResponse, error) {
+			return routeResponseTo(req.Tables, func(table string) string {
+				if table == "table_1" {
+					return broken
+				}
+				return healthy
+			}), nil
+		},
+	})
+
+	client, err := horaedb.NewClient(seed, horaedb.Direct, horaedb.WithDefaultDatabase("public"))
+	require.NoError(t, err, "init horaedb client failed")
+
+	points := buildClusterPoints(t, 2)
+	resp, err := client.Write(context.Background(), horaedb.WriteRequest{Points: points})
+	require.NoError(t, err, "write points failed")
+	require.Equal(t, uint32(1), resp.Success)
+	require.Equal(t, uint32(1), resp.Failed)
+
+	require.Len(t, resp.Failures, 1)
+	failure := resp.Failures[0]
+	require.Equal(t, broken, failure.Endpoint)
+	require.Equal(t, []string{"table_1"}, failure.Tables)
+	require.Equal(t, uint32(500), failure.Code)
+	var horaeErr *horaedb.Error
+	require.ErrorAs(t, failure.Err, &horaeErr)
+	require.Equal(t, []horaedb.Point{points[1]}, failure.Points)
+
+	retryReq, ok := resp.FailedRequest(horaedb.RequestContext{Database: "public"})
+	require.True(t, ok)
+	require.Equal(t, []horaedb.Point{points[1]}, retryReq.Points)
+	require.Equal(t, "public", retryReq.ReqCtx.Database)
+}
+
+func TestWriteSplitByMaxPoints(t *testing.T) {
+	var requests int32
+	endpoint := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			if atomic.AddInt32(&requests, 1) == 2 {
+				return &storagepb.WriteResponse{Header: &commonpb.ResponseHeader{Code: 500, Error: "disk full"}}, nil
+			}
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	})
+
+	client, err := horaedb.NewClient(endpoint, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithMaxWriteRequestPoints(10),
+		horaedb.WithWriteConcurrency(1),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	resp := writeTablePoints(t, client, "split_test", 25)
+	require.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	require.Equal(t, uint32(15), resp.Success)
+	require.Equal(t, uint32(10), resp.Failed)
+	require.Len(t, resp.Failures, 1)
+	require.Len(t, resp.Failures[0].Points, 10)
+}
+
+func TestWriteSplitByMaxBytes(t *testing.T) {
+	var requests int32
+	endpoint := startMockServer(t, &mockStorageServer{
+		writeFn: func(ctx context.Context, req *storagepb.WriteRequest) (*storagepb.WriteResponse, error) {
+			atomic.AddInt32(&requests, 1)
+			return (&mockStorageServer{}).Write(ctx, req)
+		},
+	}, grpc.MaxRecvMsgSize(64*1024))
+
+	newClient := func(opts ...horaedb.Option) horaedb.Client {
+		client, err := horaedb.NewClient(endpoint, horaedb.Proxy, append(opts, horaedb.WithDefaultDatabase("public"))...)
+		require.NoError(t, err, "init horaedb client failed")
+		t.Cleanup(func() {
+			_ = client.Close(context.Background())
+		})
+		return client
+	}
+
+	resp := writeTablePoints(t, newClient(), "split_test", 1000)
+	require.Equal(t, uint32(1000), resp.Failed, "request over the max message size of the server should fail")
+
+	resp = writeTablePoints(t, newClient(horaedb.WithMaxWriteRequestBytes(32*1024)), "split_test", 1000)
+	require.Equal(t, uint32(1000), resp.Success)
+	require.Equal(t, uint32(0), resp.Failed)
+	require.Greater(t, atomic.LoadInt32(&requests), int32(1))
+}
+
+func TestIdleEvictionKeepsOpenStream(t *testing.T) {
+	proxy := startMockServer(t, &mockStorageServer{})
+
+	client, err := horaedb.NewClient(proxy, horaedb.Proxy,
+		horaedb.WithDefaultDatabase("public"),
+		horaedb.WithConnIdleTimeout(20*time.Millisecond),
+	)
+	require.NoError(t, err, "init horaedb client failed")
+	defer func() {
+		_ = client.Close(context.Background())
+	}()
+
+	writer, err := client.(horaedb.StreamWriteClient).StreamWrite(context.Background(), horaedb.RequestContext{})
+	require.NoError(t, err, "open stream writer failed")
+	require.NoError(t, writer.Write(buildClusterPoints(t, 1)), "stream write failed")
+
+	// The conn of the proxy has no route, only the open stream keeps it from eviction.
+	time.Sleep(200 * time.Millisecond)
+	require.NoError(t, writer.Write(buildClusterPoints(t, 1)), "stream write failed")
+	resp, err := writer.Close()
+	require.NoError(t, err, "close stream writer failed")
+	require.Equal(t, uint32(2), resp.Success)
+}